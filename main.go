@@ -1,54 +1,267 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	_ "github.com/go-sql-driver/mysql"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/assets"
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"github.com/snipep/Ecommerce-application/pkg/csrf"
 	"github.com/snipep/Ecommerce-application/pkg/handlers"
+	"github.com/snipep/Ecommerce-application/pkg/health"
+	"github.com/snipep/Ecommerce-application/pkg/jobs"
+	"github.com/snipep/Ecommerce-application/pkg/logging"
+	"github.com/snipep/Ecommerce-application/pkg/metrics"
+	"github.com/snipep/Ecommerce-application/pkg/notifications"
+	"github.com/snipep/Ecommerce-application/pkg/ratelimit"
 	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"github.com/snipep/Ecommerce-application/pkg/repository/memory"
+	"github.com/snipep/Ecommerce-application/pkg/security"
+	"github.com/snipep/Ecommerce-application/pkg/server"
+	"github.com/snipep/Ecommerce-application/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-var db *sql.DB
+var db *repository.DB
 
-func initDB()  {
+//memoryDriver keeps the store in memory instead of a database
+const memoryDriver = "memory"
+
+// shutdownTimeout is how long the requests in flight get to finish once the
+// server is told to stop
+const shutdownTimeout = 30 * time.Second
+
+// rateLimits are the default rules of the rate limiter. Checkout and imports
+// are the most expensive requests, reports and exports scan many rows.
+var rateLimits = map[string]ratelimit.Rule{
+	ratelimit.DefaultRule: {IP: ratelimit.Limit{Requests: 600, Per: time.Minute}, Session: ratelimit.Limit{Requests: 300, Per: time.Minute}},
+	"cart":                {IP: ratelimit.Limit{Requests: 120, Per: time.Minute}, Session: ratelimit.Limit{Requests: 60, Per: time.Minute}},
+	"checkout":            {IP: ratelimit.Limit{Requests: 20, Per: time.Minute}, Session: ratelimit.Limit{Requests: 5, Per: time.Minute}},
+	"import":              {IP: ratelimit.Limit{Requests: 10, Per: time.Minute}},
+	"reports":             {IP: ratelimit.Limit{Requests: 60, Per: time.Minute}},
+}
+
+// newRateLimiter applies the RATE_LIMITS overrides to the default rules
+func newRateLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	rules := map[string]ratelimit.Rule{}
+	for name, rule := range rateLimits {
+		rules[name] = rule
+	}
+	for key, value := range cfg.RateLimits {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		name, scope, _ := strings.Cut(key, ".")
+		rule := rules[name]
+		switch scope {
+		case ratelimit.ScopeIP:
+			rule.IP = limit
+		case ratelimit.ScopeSession:
+			rule.Session = limit
+		default:
+			return nil, fmt.Errorf("%q: scope must be ip or session", key)
+		}
+		rules[name] = rule
+	}
+
+	var store ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "database":
+		if db == nil {
+			return nil, fmt.Errorf("the database store needs a database, the %s driver has none", cfg.DatabaseDriver)
+		}
+		store = repository.NewRateLimitRepository(db)
+	default:
+		return nil, fmt.Errorf("unknown store %q, expected memory or database", cfg.RateLimitStore)
+	}
+
+	limiter := ratelimit.NewLimiter(store, rules)
+	if cfg.RateLimitKey != "" {
+		limiter.SessionKey = []byte(cfg.RateLimitKey)
+	}
+	limiter.TrustProxy = cfg.TrustProxy
+	return limiter, nil
+}
+
+func initDB(ctx context.Context, cfg *config.Config) error {
 	var err error
-	db, err = sql.Open("mysql", "root:root@(127.0.0.1:3306)/shopping?parseTime=true")
+	db, err = repository.Open(ctx, cfg.DatabaseDriver, cfg.DatabaseDSN)
 	if err != nil{
-		log.Fatal(err)
+		return fmt.Errorf("opening database: %w", err)
 	}
 
-	if err = db.Ping();err != nil{
-		log.Fatal(err)
+	if cfg.DatabaseTimeout > 0 {
+		db.Timeouts.Default = cfg.DatabaseTimeout
+	}
+	for op, timeout := range cfg.DatabaseTimeouts {
+		db.Timeouts.Operations[op] = timeout
 	}
+
+	if err = repository.Migrate(ctx, db); err != nil {
+		db.Close()
+		return fmt.Errorf("migrating database: %w", err)
+	}
+	return nil
 }
 
 func main()  {
+	if err := run(); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(1)
+	}
+}
+
+//run serves until SIGINT or SIGTERM, errors are returned rather than exiting
+//so the deferred cleanup always runs
+func run() error {
 	r := mux.NewRouter()
+	cfg := config.Load()
+
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return fmt.Errorf("configuring logging: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	if err := handlers.LoadTemplates("."); err != nil {
+		return fmt.Errorf("loading templates: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter, cfg.TraceSampleRatio)
+	if err != nil {
+		return fmt.Errorf("configuring tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flushing traces", "err", err)
+		}
+	}()
+
+	//Load balancer probes, /readyz fails while a dependency is unusable
+	readiness := health.NewChecker(2 * time.Second)
+
+	var repo *repository.Repoitory
+	if cfg.DatabaseDriver == memoryDriver {
+		slog.Warn("keeping all data in memory, it is lost when the server stops")
+		repo = memory.NewRepository()
+	} else {
+		if err := initDB(ctx, cfg); err != nil {
+			return err
+		}
+		defer db.Close()
+		metrics.RegisterDB(db.DB, cfg.DatabaseDriver)
+		readiness.Add("database", db.PingContext)
+		readiness.Add("migrations", func(ctx context.Context) error { return repository.CheckSchema(ctx, db) })
+		repo = repository.NewRepository(db)
+	}
+
+	//Probes and scrapes are frequent and tell nothing about a request
+	probes := map[string]bool{"/metrics": true, "/healthz": true, "/readyz": true}
+
+	//Every route gets a span, except probes and static files
+	r.Use(otelmux.Middleware(tracing.ServiceName, otelmux.WithFilter(func(r *http.Request) bool {
+		return !probes[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/static/")
+	})))
+	r.Use(metrics.Middleware)
+	//Recover innermost, so the middleware above it record the failed request
+	r.Use(handlers.Recover)
+	limiter, err := newRateLimiter(cfg)
+	if err != nil {
+		return fmt.Errorf("configuring rate limits: %w", err)
+	}
+	limiter.Skip = func(r *http.Request) bool {
+		return probes[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/static/")
+	}
+	limiter.Route("cart", "/addtocart/{product_id}", "/updateorderitem")
+	limiter.Route("checkout", "/ordercomplete")
+	limiter.Route("import", "/products/import", "/products/import/{token}")
+	limiter.Route("reports", "/reports/summary", "/reports/revenue", "/reports/top-products", "/reports/statuses",
+		"/orders/export", "/products/export", "/orders/{id}/invoice.pdf")
+	go limiter.Run(ctx)
+	r.Use(limiter.Middleware(http.HandlerFunc(handlers.RateLimited)))
+	//Unsafe methods need the token the layouts send in the X-CSRF-Token header
+	r.Use(csrf.Protect(http.HandlerFunc(handlers.CSRFFailure)))
+	r.NotFoundHandler = http.HandlerFunc(handlers.NotFound)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
 
-	initDB()
-	defer db.Close()
+	readiness.Add("templates", handlers.CheckTemplates)
+	readiness.Add("uploads", health.WritableDir(handlers.UploadDir))
+	r.HandleFunc("/healthz", health.Live).Methods("GET")
+	r.HandleFunc("/readyz", readiness.Ready).Methods("GET")
 
-	fs :=http.FileServer(http.Dir("./static"))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
-	
-	repo := repository.NewRepository(db)
-	handlers := handlers.NewHandler(repo)
+	//Hashed asset names are cached for good, see the asset template function
+	r.PathPrefix(assets.Prefix).Handler(http.StripPrefix(assets.Prefix, handlers.Assets.Handler()))
+
+	//Transactional emails are queued in the outbox and delivered in the background
+	notifier := notifications.NewNotifier(repo.Outbox, handlers.Templates())
+	dispatcher := notifications.NewDispatcher(repo.Outbox, notifications.NewSMTPSender(cfg.SMTP, cfg.MailFrom))
+
+	//Slow work runs on the job runner instead of the request path
+	runner := jobs.NewRunner(repo.Jobs)
+	tasks := &jobs.Tasks{
+		Repo:       repo,
+		Notifier:   notifier,
+		Dispatcher: dispatcher,
+		UploadDir:  handlers.UploadDir,
+	}
+	tasks.Register(runner)
+	runner.Every(30*time.Second, jobs.JobFlushOutbox)
+	runner.Every(time.Hour, jobs.JobPurgeJobs)
+	//Stop the runner and wait for the jobs in flight before the database
+	//closes, also when serving fails
+	var running sync.WaitGroup
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		runner.Run(ctx)
+	}()
+	defer func() {
+		stop()
+		running.Wait()
+	}()
+
+	handlers := handlers.NewHandler(repo, runner, cfg)
 
 	//User Shopping Routes
 	r.HandleFunc("/", handlers.ShoppingHomepage).Methods("GET")
 	r.HandleFunc("/shoppingitems", handlers.ShoppingItemView).Methods("GET")
+	r.HandleFunc("/p/{slug}", handlers.ProductDetail).Methods("GET")
+	r.HandleFunc("/sitemap.xml", handlers.Sitemap).Methods("GET")
+	r.HandleFunc("/robots.txt", handlers.Robots).Methods("GET")
 	r.HandleFunc("/cartitems", handlers.CartView).Methods("GET")
 	r.HandleFunc("/addtocart/{product_id}", handlers.AddToCart).Methods("POST")
 	r.HandleFunc("/gotocart", handlers.ShoppingCartView).Methods("GET")
 	r.HandleFunc("/updateorderitem", handlers.UpdateorderItemQuantity).Methods("PUT")
-	r.HandleFunc("/ordercomplete", handlers.PlaceOrder).Methods("GET")
+	r.HandleFunc("/ordercomplete", handlers.PlaceOrder).Methods("POST")
+	r.HandleFunc("/dashboard", handlers.DashboardPage).Methods("GET")
+	r.HandleFunc("/reports/summary", handlers.ReportSummary).Methods("GET")
+	r.HandleFunc("/reports/revenue", handlers.ReportRevenue).Methods("GET")
+	r.HandleFunc("/reports/top-products", handlers.ReportTopProducts).Methods("GET")
+	r.HandleFunc("/reports/statuses", handlers.ReportOrderStatuses).Methods("GET")
 	r.HandleFunc("/manageorders", handlers.OrdersPage).Methods("GET")
 	r.HandleFunc("/allorders", handlers.AllordersView).Methods("GET")
 	r.HandleFunc("/orders", handlers.ListOrders).Methods("GET")
+	r.HandleFunc("/orders/export", handlers.ExportOrders).Methods("GET")
 	r.HandleFunc("/orders/{id}", handlers.GetOrder).Methods("GET")
+	r.HandleFunc("/orders/{id}/status", handlers.UpdateOrderStatus).Methods("PUT")
+	r.HandleFunc("/orders/{id}/invoice", handlers.IssueOrderInvoice).Methods("POST")
+	r.HandleFunc("/orders/{id}/invoice.pdf", handlers.OrderInvoice).Methods("GET")
 
 	//Admin Routes
 	//Seeding the dummy data into the database
@@ -59,6 +272,19 @@ func main()  {
 	r.HandleFunc("/allproducts", handlers.AllProductsView).Methods("GET")
 	//Present the product inside the table 
 	r.HandleFunc("/products", handlers.ListProducts).Methods("GET")
+	//Catalog import and export
+	r.HandleFunc("/importproducts", handlers.ImportProductsView).Methods("GET")
+	r.HandleFunc("/products/import", handlers.PreviewImport).Methods("POST")
+	r.HandleFunc("/products/import/{token}", handlers.ConfirmImport).Methods("POST")
+	r.HandleFunc("/products/import/{token}/errors", handlers.ImportErrors).Methods("GET")
+	r.HandleFunc("/products/export", handlers.ExportProducts).Methods("GET")
+	//Applies an action to the selected products
+	r.HandleFunc("/products/bulk", handlers.BulkProducts).Methods("POST")
+	//Previews an image picked in the product forms before it is saved
+	r.HandleFunc("/products/image-preview", handlers.PreviewProductImage).Methods("POST")
+	//Adds images to and removes them from the gallery of a product
+	r.HandleFunc("/products/{id}/images", handlers.AddProductImages).Methods("POST")
+	r.HandleFunc("/products/{id}/images/{image}", handlers.RemoveProductImage).Methods("DELETE")
 	//Handle the product view
 	r.HandleFunc("/products/{id}", handlers.GetProduct).Methods("GET")
 	//Handle the create product page
@@ -71,10 +297,35 @@ func main()  {
 	r.HandleFunc("/products/{id}", handlers.UpdateProduct).Methods("PUT")
 	//Deleting product
 	r.HandleFunc("/products/{id}", handlers.DeleteProduct).Methods("DELETE")
+	//Browse the audit trail of admin changes
+	r.HandleFunc("/audit", handlers.AuditPage).Methods("GET")
+	r.HandleFunc("/audit/entries", handlers.ListAudit).Methods("GET")
+
 
 
+	srv, err := server.New(cfg.Addr, logging.Middleware(security.Headers(cfg.TrustProxy)(r)), cfg.TLS)
+	if err != nil {
+		return fmt.Errorf("configuring server: %w", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+	slog.Info("server running", "addr", cfg.Addr, "mode", srv.Mode, "redirect_addr", cfg.TLS.RedirectAddr, "database", cfg.DatabaseDriver)
 
-	fmt.Println("Server running on Port :5000")
-	http.ListenAndServe(":5000", r)
-	
+	select {
+	case err := <-served:
+		return fmt.Errorf("serving http: %w", err)
+	case <-ctx.Done():
+	}
+
+	//Finish the requests in flight, then let the deferred cleanup run
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,128 @@
+// Package assets serves the files under static/ with content hashed names, so
+// browsers can cache them for good and still pick up every change on deploy.
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Prefix is the URL path the static directory is served under
+const Prefix = "/static/"
+
+// Uploads holds user content, it's served under its own name as files there
+// are added after start
+const Uploads = "uploads"
+
+// immutable is the Cache-Control of hashed files, their content never changes
+const immutable = "public, max-age=31536000, immutable"
+
+// Manifest maps the files of the static directory to their hashed names. It
+// is built once, files changed afterwards keep their old hash until restart.
+type Manifest struct {
+	dir     string
+	hashed  map[string]string
+	logical map[string]string
+	missing sync.Map
+}
+
+// Load hashes every file under dir, except uploads
+func Load(dir string) (*Manifest, error) {
+	m := &Manifest{
+		dir:     dir,
+		hashed:  map[string]string{},
+		logical: map[string]string{},
+	}
+
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if name == Uploads {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		hashedName := hashName(name, sum)
+		m.hashed[name] = hashedName
+		m.logical[hashedName] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// hashName puts the hash before the extension, "js/app.js" becomes
+// "js/app.<hash>.js"
+func hashName(name, sum string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + sum + ext
+}
+
+// URL returns the URL of a file in the static directory, e.g. "css/admin.css".
+// Files that don't exist keep their name, a warning is logged once for each.
+func (m *Manifest) URL(name string) string {
+	if hashedName, ok := m.hashed[name]; ok {
+		return Prefix + hashedName
+	}
+	if _, warned := m.missing.LoadOrStore(name, true); !warned {
+		slog.Warn("static asset not found", "name", name, "dir", m.dir)
+	}
+	return Prefix + name
+}
+
+// Handler serves the static directory, it expects Prefix to be stripped.
+// Hashed names are cached for a year, anything else is revalidated.
+func (m *Manifest) Handler() http.Handler {
+	files := http.FileServer(http.Dir(m.dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if logical, ok := m.logical[name]; ok {
+			w.Header().Set("Cache-Control", immutable)
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + logical
+			r2.URL.RawPath = ""
+			files.ServeHTTP(w, r2)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
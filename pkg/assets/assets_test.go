@@ -0,0 +1,66 @@
+package assets
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// assetCall matches the asset function of the templates called with a literal name
+var assetCall = regexp.MustCompile(`\basset\s+"([^"]+)"`)
+
+// TestTemplateAssetsExist fails for every file a template links through asset
+// that static doesn't have, e.g. vendored libraries that weren't committed
+func TestTemplateAssetsExist(t *testing.T) {
+	m, err := Load(filepath.Join("..", "..", "static"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	err = filepath.WalkDir(filepath.Join("..", "..", "templates"), func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(file) != ".html" {
+			return err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		for _, match := range assetCall.FindAllStringSubmatch(string(content), -1) {
+			found++
+			if _, ok := m.hashed[match[1]]; !ok {
+				t.Errorf("%s links %q, which is not in static (run scripts/vendor-assets.sh for vendor files)", file, match[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == 0 {
+		t.Fatal("no asset references found in templates")
+	}
+}
+
+func TestHashedURL(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "js"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "js", "app.js"), []byte("alert(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.URL("js/app.js"); !regexp.MustCompile(`^/static/js/app\.[0-9a-f]{12}\.js$`).MatchString(got) {
+		t.Errorf("URL(js/app.js) = %q, want a hashed name", got)
+	}
+	if got := m.URL("js/missing.js"); got != "/static/js/missing.js" {
+		t.Errorf("URL(js/missing.js) = %q, want the name unchanged", got)
+	}
+}
@@ -0,0 +1,363 @@
+// Package catalog reads and writes the product catalog in the CSV and JSON
+// formats used for bulk import and export.
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// MaxPrice is the largest price the DECIMAL(10,2) price column holds.
+const MaxPrice = 99999999.99
+
+// Columns are the fields of a catalog file, in export order.
+var Columns = []string{"sku", "product_name", "price", "description", "category", "product_image", "archived"}
+
+// Record is one product as it appears in a catalog file. Prices and flags
+// are kept as text so they can be validated with a useful message.
+type Record struct {
+	SKU          string `json:"sku"`
+	ProductName  string `json:"product_name"`
+	Price        string `json:"price"`
+	Description  string `json:"description"`
+	Category     string `json:"category"`
+	ProductImage string `json:"product_image"`
+	Archived     string `json:"archived"`
+}
+
+// Row is a validated record ready to be imported.
+type Row struct {
+	Line    int
+	Product models.Product
+}
+
+type RowError struct {
+	Line    int
+	SKU     string
+	Field   string
+	Message string
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s %s", e.Line, e.Field, e.Message)
+}
+
+// Parse reads a catalog in the given format ("csv" or "json") and validates
+// every record. Rows with errors are left out of the returned rows.
+func Parse(r io.Reader, format string) ([]Row, []RowError, error) {
+	var records []Record
+	var firstLine int
+	var err error
+
+	switch format {
+	case "csv":
+		records, err = readCSV(r)
+		firstLine = 2 // line 1 is the header
+	case "json":
+		records, err = readJSON(r)
+		firstLine = 1
+	default:
+		return nil, nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+	seen := make(map[string]int)
+	images := make(map[string]int)
+
+	for i, record := range records {
+		line := firstLine + i
+		product, errs := validate(record, line)
+
+		// SKUs are case sensitive, like in the database
+		if product.SKU != "" {
+			if previous, ok := seen[product.SKU]; ok {
+				errs = append(errs, RowError{Line: line, SKU: record.SKU, Field: "sku", Message: fmt.Sprintf("is a duplicate of line %d", previous)})
+			} else {
+				seen[product.SKU] = line
+			}
+		}
+
+		// Only the placeholder may be shared, each other image belongs to one product
+		if image := product.ProductImage; image != "" && image != models.PlaceholderImage {
+			if previous, ok := images[image]; ok {
+				errs = append(errs, RowError{Line: line, SKU: record.SKU, Field: "product_image", Message: fmt.Sprintf("is already used on line %d", previous)})
+			} else {
+				images[image] = line
+			}
+		}
+
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
+		rows = append(rows, Row{Line: line, Product: product})
+	}
+	return rows, rowErrors, nil
+}
+
+func validate(record Record, line int) (models.Product, []RowError) {
+	var errs []RowError
+	fail := func(field, message string) {
+		errs = append(errs, RowError{Line: line, SKU: record.SKU, Field: field, Message: message})
+	}
+
+	product := models.Product{
+		SKU:          strings.TrimSpace(record.SKU),
+		ProductName:  strings.TrimSpace(record.ProductName),
+		Description:  strings.TrimSpace(record.Description),
+		Category:     strings.TrimSpace(record.Category),
+		ProductImage: strings.TrimSpace(record.ProductImage),
+	}
+
+	if product.SKU == "" {
+		fail("sku", "is required")
+	} else if len(product.SKU) > 64 {
+		fail("sku", "must be at most 64 characters")
+	}
+	if product.ProductName == "" {
+		fail("product_name", "is required")
+	} else if len(product.ProductName) > 255 {
+		fail("product_name", "must be at most 255 characters")
+	}
+	if product.Description == "" {
+		fail("description", "is required")
+	}
+	if len(product.Category) > 100 {
+		fail("category", "must be at most 100 characters")
+	}
+	if strings.ContainsAny(product.ProductImage, `/\`) {
+		fail("product_image", "must be a file name in static/uploads")
+	}
+
+	// ParseFloat accepts "NaN" and "Inf", neither is a price
+	price, err := strconv.ParseFloat(strings.TrimSpace(record.Price), 64)
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+		fail("price", "must be a number")
+	} else if price < 0 {
+		fail("price", "must not be negative")
+	} else if price > MaxPrice {
+		fail("price", fmt.Sprintf("must be at most %.2f", MaxPrice))
+	}
+	product.Price = price
+
+	switch strings.ToLower(strings.TrimSpace(record.Archived)) {
+	case "", "false", "0", "no":
+	case "true", "1", "yes":
+		product.Archived = true
+	default:
+		fail("archived", "must be true or false")
+	}
+
+	return product, errs
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Spreadsheet programs often start the file with a byte order mark
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"sku", "product_name", "price", "description"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("the header is missing the %q column", required)
+		}
+	}
+
+	field := func(values []string, name string) string {
+		if i, ok := index[name]; ok && i < len(values) {
+			return UnescapeCell(values[i])
+		}
+		return ""
+	}
+
+	var records []Record
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, Record{
+			SKU:          field(values, "sku"),
+			ProductName:  field(values, "product_name"),
+			Price:        field(values, "price"),
+			Description:  field(values, "description"),
+			Category:     field(values, "category"),
+			ProductImage: field(values, "product_image"),
+			Archived:     field(values, "archived"),
+		})
+	}
+	return records, nil
+}
+
+func readJSON(r io.Reader) ([]Record, error) {
+	// Prices and flags may be written as JSON numbers and booleans
+	var raw []map[string]any
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("the file must contain a JSON array of products: %w", err)
+	}
+
+	text := func(values map[string]any, name string) string {
+		switch value := values[name].(type) {
+		case nil:
+			return ""
+		case string:
+			return value
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			return fmt.Sprint(value)
+		}
+	}
+
+	records := make([]Record, 0, len(raw))
+	for _, values := range raw {
+		records = append(records, Record{
+			SKU:          text(values, "sku"),
+			ProductName:  text(values, "product_name"),
+			Price:        text(values, "price"),
+			Description:  text(values, "description"),
+			Category:     text(values, "category"),
+			ProductImage: text(values, "product_image"),
+			Archived:     text(values, "archived"),
+		})
+	}
+	return records, nil
+}
+
+// formulaPrefixes start a cell spreadsheet programs evaluate as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// EscapeCell makes spreadsheet programs show text as text, by quoting values
+// that would otherwise run as a formula when the CSV file is opened.
+func EscapeCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// UnescapeCell reverts EscapeCell, so an exported catalog imports unchanged.
+func UnescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// WriteCSV writes products as a CSV catalog with a header row.
+func WriteCSV(w io.Writer, products []models.Product) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, product := range products {
+		if err := writer.Write([]string{
+			EscapeCell(product.SKU),
+			EscapeCell(product.ProductName),
+			strconv.FormatFloat(product.Price, 'f', 2, 64),
+			EscapeCell(product.Description),
+			EscapeCell(product.Category),
+			EscapeCell(product.ProductImage),
+			strconv.FormatBool(product.Archived),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type jsonProduct struct {
+	SKU          string  `json:"sku"`
+	ProductName  string  `json:"product_name"`
+	Price        float64 `json:"price"`
+	Description  string  `json:"description"`
+	Category     string  `json:"category"`
+	ProductImage string  `json:"product_image"`
+	Archived     bool    `json:"archived"`
+}
+
+// WriteJSON writes products as a JSON array, the same shape Parse accepts.
+func WriteJSON(w io.Writer, products []models.Product) error {
+	out := make([]jsonProduct, 0, len(products))
+	for _, product := range products {
+		out = append(out, jsonProduct{
+			SKU:          product.SKU,
+			ProductName:  product.ProductName,
+			Price:        product.Price,
+			Description:  product.Description,
+			Category:     product.Category,
+			ProductImage: product.ProductImage,
+			Archived:     product.Archived,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// WriteErrorsCSV writes a downloadable report of the rows that failed validation.
+func WriteErrorsCSV(w io.Writer, rowErrors []RowError) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"line", "sku", "field", "error"}); err != nil {
+		return err
+	}
+	for _, e := range rowErrors {
+		if err := writer.Write([]string{strconv.Itoa(e.Line), EscapeCell(e.SKU), e.Field, EscapeCell(e.Message)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Changes lists the fields an import would change on an existing product.
+func Changes(existing, imported models.Product) []string {
+	var changes []string
+	if existing.ProductName != imported.ProductName {
+		changes = append(changes, "name")
+	}
+	if existing.Price != imported.Price {
+		changes = append(changes, fmt.Sprintf("price $%.2f → $%.2f", existing.Price, imported.Price))
+	}
+	if existing.Description != imported.Description {
+		changes = append(changes, "description")
+	}
+	if existing.Category != imported.Category {
+		changes = append(changes, "category")
+	}
+	if imported.ProductImage != "" && existing.ProductImage != imported.ProductImage {
+		changes = append(changes, "image")
+	}
+	if existing.Archived != imported.Archived {
+		changes = append(changes, "archived")
+	}
+	return changes
+}
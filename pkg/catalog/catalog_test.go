@@ -0,0 +1,209 @@
+package catalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+func validRecord() Record {
+	return Record{SKU: "MUG-1", ProductName: "Mug", Price: "12.50", Description: "A mug"}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(r *Record)
+		wantField string
+	}{
+		{name: "valid", change: func(r *Record) {}},
+		{name: "missing sku", change: func(r *Record) { r.SKU = "  " }, wantField: "sku"},
+		{name: "longest sku", change: func(r *Record) { r.SKU = strings.Repeat("s", 64) }},
+		{name: "sku too long", change: func(r *Record) { r.SKU = strings.Repeat("s", 65) }, wantField: "sku"},
+		{name: "missing name", change: func(r *Record) { r.ProductName = "" }, wantField: "product_name"},
+		{name: "longest name", change: func(r *Record) { r.ProductName = strings.Repeat("n", 255) }},
+		{name: "name too long", change: func(r *Record) { r.ProductName = strings.Repeat("n", 256) }, wantField: "product_name"},
+		{name: "missing description", change: func(r *Record) { r.Description = "" }, wantField: "description"},
+		{name: "longest category", change: func(r *Record) { r.Category = strings.Repeat("c", 100) }},
+		{name: "category too long", change: func(r *Record) { r.Category = strings.Repeat("c", 101) }, wantField: "category"},
+		{name: "image in a directory", change: func(r *Record) { r.ProductImage = "../main.go" }, wantField: "product_image"},
+		{name: "free", change: func(r *Record) { r.Price = "0" }},
+		{name: "highest price", change: func(r *Record) { r.Price = "99999999.99" }},
+		{name: "price too high", change: func(r *Record) { r.Price = "100000000" }, wantField: "price"},
+		{name: "price out of range", change: func(r *Record) { r.Price = "1e400" }, wantField: "price"},
+		{name: "negative price", change: func(r *Record) { r.Price = "-1" }, wantField: "price"},
+		{name: "NaN price", change: func(r *Record) { r.Price = "NaN" }, wantField: "price"},
+		{name: "infinite price", change: func(r *Record) { r.Price = "Inf" }, wantField: "price"},
+		{name: "negative infinite price", change: func(r *Record) { r.Price = "-Inf" }, wantField: "price"},
+		{name: "text price", change: func(r *Record) { r.Price = "cheap" }, wantField: "price"},
+		{name: "archived", change: func(r *Record) { r.Archived = "Yes" }},
+		{name: "unknown archived", change: func(r *Record) { r.Archived = "maybe" }, wantField: "archived"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := validRecord()
+			tt.change(&record)
+			_, errs := validate(record, 7)
+
+			if tt.wantField == "" {
+				if len(errs) != 0 {
+					t.Errorf("errors %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Field != tt.wantField || errs[0].Line != 7 {
+				t.Errorf("errors %v, want one for %s on line 7", errs, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestValidateTrims(t *testing.T) {
+	product, errs := validate(Record{SKU: " MUG-1 ", ProductName: " Mug ", Price: " 12.5 ", Description: " A mug ", Archived: "TRUE"}, 2)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if product.SKU != "MUG-1" || product.ProductName != "Mug" || product.Price != 12.5 || product.Description != "A mug" || !product.Archived {
+		t.Errorf("product %+v", product)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		input      string
+		wantSKUs   []string
+		wantErrors []RowError
+	}{
+		{
+			name:     "csv",
+			format:   "csv",
+			input:    "\ufeffSKU,product_name,price,description,archived\nMUG-1,Mug,12.50,A mug,false\nCUP-1,'=Cup,3,A cup,true\n",
+			wantSKUs: []string{"MUG-1", "CUP-1"},
+		},
+		{
+			name:     "json",
+			format:   "json",
+			input:    `[{"sku": "MUG-1", "product_name": "Mug", "price": 12.5, "description": "A mug", "archived": false}, {"sku": "CUP-1", "product_name": "Cup", "price": "3", "description": "A cup", "archived": true}]`,
+			wantSKUs: []string{"MUG-1", "CUP-1"},
+		},
+		{
+			name:       "duplicate sku in csv",
+			format:     "csv",
+			input:      "sku,product_name,price,description\nMUG-1,Mug,1,A mug\nmug-1,Mug,1,A mug\nMUG-1,Mug,1,A mug\n",
+			wantSKUs:   []string{"MUG-1", "mug-1"},
+			wantErrors: []RowError{{Line: 4, SKU: "MUG-1", Field: "sku", Message: "is a duplicate of line 2"}},
+		},
+		{
+			name:       "duplicate sku in json",
+			format:     "json",
+			input:      `[{"sku": "MUG-1", "product_name": "Mug", "price": 1, "description": "A mug"}, {"sku": " MUG-1", "product_name": "Mug", "price": 1, "description": "A mug"}]`,
+			wantSKUs:   []string{"MUG-1"},
+			wantErrors: []RowError{{Line: 2, SKU: " MUG-1", Field: "sku", Message: "is a duplicate of line 1"}},
+		},
+		{
+			name:       "shared image",
+			format:     "csv",
+			input:      "sku,product_name,price,description,product_image\nA,Mug,1,A mug,mug.jpg\nB,Mug,1,A mug,mug.jpg\nC,Mug,1,A mug," + models.PlaceholderImage + "\nD,Mug,1,A mug," + models.PlaceholderImage + "\n",
+			wantSKUs:   []string{"A", "C", "D"},
+			wantErrors: []RowError{{Line: 3, SKU: "B", Field: "product_image", Message: "is already used on line 2"}},
+		},
+		{
+			name:       "invalid rows are left out",
+			format:     "json",
+			input:      `[{"sku": "A", "product_name": "Mug", "price": "NaN", "description": "A mug"}, {"sku": "B", "product_name": "Mug", "price": 1, "description": "A mug"}]`,
+			wantSKUs:   []string{"B"},
+			wantErrors: []RowError{{Line: 1, SKU: "A", Field: "price", Message: "must be a number"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, rowErrors, err := Parse(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var skus []string
+			for _, row := range rows {
+				skus = append(skus, row.Product.SKU)
+			}
+			if strings.Join(skus, ",") != strings.Join(tt.wantSKUs, ",") {
+				t.Errorf("rows %v, want %v", skus, tt.wantSKUs)
+			}
+			if len(rowErrors) != len(tt.wantErrors) {
+				t.Fatalf("errors %v, want %v", rowErrors, tt.wantErrors)
+			}
+			for i := range rowErrors {
+				if rowErrors[i] != tt.wantErrors[i] {
+					t.Errorf("error %+v, want %+v", rowErrors[i], tt.wantErrors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseUnescapesCells(t *testing.T) {
+	rows, _, err := Parse(strings.NewReader("sku,product_name,price,description\nCUP-1,'=Cup,3,A cup\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Product.ProductName != "=Cup" || rows[0].Line != 2 {
+		t.Errorf("rows %+v", rows)
+	}
+}
+
+func TestParseRejectsFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{name: "empty csv", format: "csv", input: ""},
+		{name: "missing column", format: "csv", input: "sku,product_name,description\nA,Mug,A mug\n"},
+		{name: "ragged csv", format: "csv", input: "sku,product_name,price,description\nA,Mug\n"},
+		{name: "json object", format: "json", input: `{"sku": "A"}`},
+		{name: "unknown format", format: "xml", input: "<products/>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Parse(strings.NewReader(tt.input), tt.format); err == nil {
+				t.Error("the file was accepted")
+			}
+		})
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	products := []models.Product{
+		{SKU: "MUG-1", ProductName: "=HYPERLINK(\"x\")", Price: 12.5, Description: "A mug, blue", Category: "Kitchen", ProductImage: "mug.jpg"},
+		{SKU: "CUP-1", ProductName: "Cup", Price: MaxPrice, Description: "A cup", Archived: true},
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			write := WriteCSV
+			if format == "json" {
+				write = WriteJSON
+			}
+			if err := write(&buf, products); err != nil {
+				t.Fatal(err)
+			}
+
+			rows, rowErrors, err := Parse(&buf, format)
+			if err != nil || len(rowErrors) != 0 {
+				t.Fatalf("err %v, row errors %v", err, rowErrors)
+			}
+			if len(rows) != len(products) {
+				t.Fatalf("%d rows, want %d", len(rows), len(products))
+			}
+			for i, row := range rows {
+				if len(Changes(products[i], row.Product)) != 0 || row.Product.SKU != products[i].SKU {
+					t.Errorf("row %d: %+v, want %+v", i, row.Product, products[i])
+				}
+			}
+		})
+	}
+}
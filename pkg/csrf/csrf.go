@@ -0,0 +1,181 @@
+// Package csrf protects state-changing requests against cross-site request
+// forgery. Each visitor gets a random secret in a cookie, pages embed a
+// masked copy of it and unsafe requests must send that copy back, in the
+// X-CSRF-Token header or, for urlencoded form posts, the csrf_token form
+// field. A cross-site page can neither read the cookie nor the page, so it
+// can't produce the token.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+const (
+	// HeaderName is the header htmx sends the token in
+	HeaderName = "X-CSRF-Token"
+	// FieldName is the form field for plain urlencoded form posts. Uploads
+	// must use the header, the middleware does not parse multipart bodies.
+	FieldName = "csrf_token"
+	// CookieName holds the visitor's secret
+	CookieName = "csrf_secret"
+
+	secretLength = 32
+	cookieMaxAge = 30 * 24 * 60 * 60
+)
+
+var (
+	ErrMissingToken = errors.New("csrf token missing")
+	ErrInvalidToken = errors.New("csrf token invalid")
+)
+
+type stateKey struct{}
+type errorKey struct{}
+
+// state is the visitor's secret. A new secret is only sent, along with the
+// response, once a token is handed out, so static files and other responses
+// without a token carry no cookie and stay cacheable.
+type state struct {
+	secret []byte
+	fresh  bool
+	w      http.ResponseWriter
+	secure bool
+}
+
+// Protect returns middleware that hands out secrets and checks the token of
+// every request with an unsafe method. Rejected requests are passed to
+// onFailure, Failure tells it why.
+func Protect(onFailure http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, ok := readSecret(r)
+			st := &state{secret: secret, fresh: !ok, w: w, secure: r.TLS != nil}
+			if !ok {
+				st.secret = make([]byte, secretLength)
+				if _, err := rand.Read(st.secret); err != nil {
+					panic(err)
+				}
+			}
+			r = r.WithContext(context.WithValue(r.Context(), stateKey{}, st))
+
+			if !safeMethod(r.Method) {
+				if err := check(r, secret, ok); err != nil {
+					r = r.WithContext(context.WithValue(r.Context(), errorKey{}, err))
+					onFailure.ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Token returns a masked token for the visitor of r, it must be called before
+// the response is written. It changes on every call, so it can't be recovered
+// by compressing it along with guessed text.
+func Token(r *http.Request) string {
+	st, ok := r.Context().Value(stateKey{}).(*state)
+	if !ok {
+		return ""
+	}
+	if st.fresh {
+		http.SetCookie(st.w, &http.Cookie{
+			Name:     CookieName,
+			Value:    base64.RawURLEncoding.EncodeToString(st.secret),
+			Path:     "/",
+			MaxAge:   cookieMaxAge,
+			HttpOnly: true,
+			Secure:   st.secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+		st.fresh = false
+	}
+	//Responses carrying a token must not be shared between visitors
+	st.w.Header().Add("Vary", "Cookie")
+	return mask(st.secret)
+}
+
+// Failure returns why the request passed to the failure handler was rejected
+func Failure(r *http.Request) error {
+	err, _ := r.Context().Value(errorKey{}).(error)
+	return err
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func readSecret(r *http.Request) ([]byte, bool) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(secret) != secretLength {
+		return nil, false
+	}
+	return secret, true
+}
+
+// check compares the submitted token with secret. Without a secret cookie
+// the request can't be valid, a new secret was just issued.
+func check(r *http.Request, secret []byte, hadSecret bool) error {
+	token := r.Header.Get(HeaderName)
+	if token == "" && urlencoded(r) {
+		token = r.PostFormValue(FieldName)
+	}
+	if token == "" {
+		return ErrMissingToken
+	}
+	if !hadSecret {
+		return ErrInvalidToken
+	}
+
+	submitted, ok := unmask(token)
+	if !ok || subtle.ConstantTimeCompare(submitted, secret) != 1 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// urlencoded reports whether the body of r is a urlencoded form. Only those
+// are searched for the form field, net/http caps them at 10MB. Multipart
+// bodies would be read in full before the token could be checked.
+func urlencoded(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// mask XORs secret with a one-time pad and prepends the pad
+func mask(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	pad := token[:len(secret)]
+	if _, err := rand.Read(pad); err != nil {
+		panic(err)
+	}
+	for i := range secret {
+		token[len(secret)+i] = secret[i] ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func unmask(token string) ([]byte, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 2*secretLength {
+		return nil, false
+	}
+	secret := make([]byte, secretLength)
+	for i := range secret {
+		secret[i] = raw[i] ^ raw[secretLength+i]
+	}
+	return secret, true
+}
@@ -0,0 +1,165 @@
+package csrf
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newTestServer protects a handler that answers with a fresh token. Rejected
+// requests get a 403 with the reason in X-Failure.
+func newTestServer() http.Handler {
+	onFailure := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Failure", Failure(r).Error())
+		w.WriteHeader(http.StatusForbidden)
+	})
+	return Protect(onFailure)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, Token(r))
+	}))
+}
+
+// visit fetches a page and returns the secret cookie and the token it
+// embeds
+func visit(t *testing.T, handler http.Handler) (*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: status %d", w.Code)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == CookieName {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Errorf("cookie %+v", cookie)
+			}
+			return cookie, w.Body.String()
+		}
+	}
+	t.Fatal("no secret cookie")
+	return nil, ""
+}
+
+// unreadable fails the test if the middleware reads the body
+type unreadable struct{ t *testing.T }
+
+func (b unreadable) Read(p []byte) (int, error) {
+	b.t.Error("the multipart body was read")
+	return 0, io.EOF
+}
+
+func TestProtect(t *testing.T) {
+	handler := newTestServer()
+	cookie, token := visit(t, handler)
+	otherCookie, otherToken := visit(t, handler)
+
+	//The last character carries unused bits, change one in the middle
+	tampered := []byte(token)
+	if tampered[50] == 'A' {
+		tampered[50] = 'B'
+	} else {
+		tampered[50] = 'A'
+	}
+
+	form := func(token string) io.Reader {
+		return strings.NewReader(url.Values{FieldName: {token}}.Encode())
+	}
+
+	tests := []struct {
+		name        string
+		cookie      *http.Cookie
+		header      string
+		contentType string
+		body        func(t *testing.T) io.Reader
+		wantErr     error
+	}{
+		{name: "header", cookie: cookie, header: token},
+		{name: "form field", cookie: cookie, contentType: "application/x-www-form-urlencoded", body: func(*testing.T) io.Reader { return form(token) }},
+		{name: "form field with charset", cookie: cookie, contentType: "application/x-www-form-urlencoded; charset=UTF-8", body: func(*testing.T) io.Reader { return form(token) }},
+		{name: "multipart with header", cookie: cookie, header: token, contentType: "multipart/form-data; boundary=x", body: func(t *testing.T) io.Reader { return unreadable{t} }},
+		{name: "multipart without header", cookie: cookie, contentType: "multipart/form-data; boundary=x", body: func(t *testing.T) io.Reader { return unreadable{t} }, wantErr: ErrMissingToken},
+		{name: "missing", cookie: cookie, wantErr: ErrMissingToken},
+		{name: "no cookie", header: token, wantErr: ErrInvalidToken},
+		{name: "other visitor's token", cookie: cookie, header: otherToken, wantErr: ErrInvalidToken},
+		{name: "other visitor's cookie", cookie: otherCookie, header: token, wantErr: ErrInvalidToken},
+		{name: "tampered", cookie: cookie, header: string(tampered), wantErr: ErrInvalidToken},
+		{name: "not base64", cookie: cookie, header: "!!!", wantErr: ErrInvalidToken},
+		{name: "unmasked secret", cookie: cookie, header: cookie.Value, wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != nil {
+				body = tt.body(t)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", body)
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				r.Header.Set(HeaderName, tt.header)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if tt.wantErr == nil {
+				if w.Code != http.StatusOK {
+					t.Errorf("status %d: %s", w.Code, w.Header().Get("X-Failure"))
+				}
+				return
+			}
+			if w.Code != http.StatusForbidden || w.Header().Get("X-Failure") != tt.wantErr.Error() {
+				t.Errorf("status %d: %q, want %v", w.Code, w.Header().Get("X-Failure"), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSafeMethodsSkipTheCheck(t *testing.T) {
+	handler := newTestServer()
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", method, w.Code)
+		}
+	}
+}
+
+func TestTokenIsMasked(t *testing.T) {
+	handler := newTestServer()
+	cookie, first := visit(t, handler)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	second := w.Body.String()
+
+	//A visitor with a secret keeps it, but never sees the same token twice
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("the secret was issued again")
+	}
+	if first == second {
+		t.Error("the token did not change")
+	}
+	a, okA := unmask(first)
+	b, okB := unmask(second)
+	if !okA || !okB || string(a) != string(b) {
+		t.Error("the tokens hide different secrets")
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Cookie") {
+		t.Error("a response with a token is not marked Vary: Cookie")
+	}
+}
+
+func TestFailureOutsideTheFailureHandler(t *testing.T) {
+	if err := Failure(httptest.NewRequest(http.MethodGet, "/", nil)); err != nil {
+		t.Errorf("Failure = %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/snipep/Ecommerce-application/pkg/logging"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"github.com/snipep/Ecommerce-application/pkg/security"
+)
+
+// Audited actions
+const (
+	AuditProductCreate = "product.create"
+	AuditProductUpdate = "product.update"
+	AuditProductDelete = "product.delete"
+	AuditProductSeed   = "product.seed"
+	AuditProductImport = "product.import"
+	AuditOrderStatus   = "order.status"
+)
+
+// auditActions are offered by the audit log filter, bulk actions are
+// recorded as "product.bulk_" followed by the action
+var auditActions = []string{
+	AuditProductCreate,
+	AuditProductUpdate,
+	AuditProductDelete,
+	AuditProductSeed,
+	AuditProductImport,
+	"product.bulk_" + repository.BulkArchive,
+	"product.bulk_" + repository.BulkUnarchive,
+	"product.bulk_" + repository.BulkDelete,
+	"product.bulk_" + repository.BulkPrice,
+	"product.bulk_" + repository.BulkCategory,
+	AuditOrderStatus,
+}
+
+// actor is the admin making the request. Only a trusted proxy can vouch for
+// them, until the admin pages have logins of their own. Without one the
+// client IP is all that tells admins apart.
+func (h *Handler) actor(r *http.Request) string {
+	if h.Config.TrustProxy {
+		if user := strings.TrimSpace(r.Header.Get("X-Forwarded-User")); user != "" {
+			return user
+		}
+	}
+	return "anonymous@" + security.ClientIP(r, h.Config.TrustProxy)
+}
+
+// audited returns the context of r for changes to record as action. The
+// stores write the audit entry in the transaction of the change, so a change
+// is never kept without its entry.
+func (h *Handler) audited(r *http.Request, action string) context.Context {
+	return repository.WithAudit(r.Context(), models.AuditEntry{
+		Actor:     h.actor(r),
+		RemoteIP:  security.ClientIP(r, h.Config.TrustProxy),
+		RequestID: logging.RequestID(r.Context()),
+		Action:    action,
+	})
+}
+
+// AuditListView is the audit log, always sorted newest first
+type AuditListView struct {
+	Page
+	ListView
+	Actions     []string
+	EntityTypes []string
+}
+
+func newAuditListView(params url.Values) AuditListView {
+	return AuditListView{
+		ListView:    newListView(params, nil),
+		Actions:     auditActions,
+		EntityTypes: []string{models.AuditProduct, models.AuditOrder},
+	}
+}
+
+func (h *Handler) AuditPage(w http.ResponseWriter, r *http.Request) {
+	view := newAuditListView(r.URL.Query())
+	view.Page = newPage(r)
+	render(w, r, "audit", view)
+}
+
+func parseAuditFilter(params url.Values) repository.AuditFilter {
+	filter := repository.AuditFilter{
+		Actor:      strings.TrimSpace(params.Get("actor")),
+		Action:     params.Get("action"),
+		EntityType: params.Get("entity_type"),
+		EntityID:   strings.TrimSpace(params.Get("entity_id")),
+		DateFrom:   parseDate(params.Get("from")),
+	}
+
+	//The "to" date is inclusive
+	if to := parseDate(params.Get("to")); !to.IsZero() {
+		filter.DateTo = to.AddDate(0, 0, 1)
+	}
+	return filter
+}
+
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, limit := parsePaging(params)
+
+	filter := parseAuditFilter(params)
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	entries, err := h.Repo.Audit.SearchAudit(r.Context(), filter)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	totalEntries, err := h.Repo.Audit.CountAudit(r.Context(), filter)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(totalEntries) / float64(limit)))
+
+	data := struct {
+		ListView
+		Entries          []models.AuditEntry
+		TotalEntries     int
+		CurrentPage      int
+		TotalPages       int
+		Limit            int
+		PreviousPage     int
+		NextPage         int
+		PageButtonsRange []int
+	}{
+		ListView:         newListView(params, nil),
+		Entries:          entries,
+		TotalEntries:     totalEntries,
+		CurrentPage:      page,
+		TotalPages:       totalPages,
+		Limit:            limit,
+		PreviousPage:     page - 1,
+		NextPage:         page + 1,
+		PageButtonsRange: makeRange(1, totalPages),
+	}
+
+	//Keep the filters in the address bar so the filtered view can be bookmarked
+	if r.Header.Get("HX-Request") == "true" {
+		pushURL := "/audit"
+		if query := cleanParams(params).Encode(); query != "" {
+			pushURL += "?" + query
+		}
+		w.Header().Set("HX-Push-Url", pushURL)
+	}
+
+	render(w, r, "auditRows", data)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/csrf"
+	"github.com/snipep/Ecommerce-application/pkg/logging"
+	"github.com/snipep/Ecommerce-application/pkg/metrics"
+	"github.com/snipep/Ecommerce-application/pkg/ratelimit"
+)
+
+// alertsTarget is the element of every layout that error alerts are swapped into
+const alertsTarget = "#alerts"
+
+// ErrorView is rendered by the errorAlert template
+type ErrorView struct {
+	Message string
+	// RequestID is shown for internal errors so they can be looked up in the logs
+	RequestID string
+}
+
+// respondError reports err to the client. The message and status come from
+// apperr, anything that isn't an apperr.Error is logged and described as an
+// internal failure. HTMX requests get an alert fragment swapped into the
+// alerts area of the page, API clients get JSON and browsers plain text.
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	status := apperr.Status(err)
+	view := ErrorView{Message: apperr.Message(err)}
+
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		view.RequestID = logging.RequestID(r.Context())
+	} else {
+		slog.DebugContext(r.Context(), "request rejected", "method", r.Method, "path", r.URL.Path, "err", err)
+	}
+
+	switch {
+	case r.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Retarget", alertsTarget)
+		w.Header().Set("HX-Reswap", "innerHTML")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		render(w, r, "errorAlert", view)
+	case wantsJSON(r):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		writeJSON(w, struct {
+			Error     string `json:"error"`
+			Status    int    `json:"status"`
+			RequestID string `json:"request_id,omitempty"`
+		}{view.Message, status, view.RequestID})
+	default:
+		http.Error(w, view.Message, status)
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// badRequest reports invalid input described by message
+func badRequest(w http.ResponseWriter, r *http.Request, message string) {
+	respondError(w, r, apperr.Validation("%s", message))
+}
+
+// CSRFFailure answers requests rejected by the csrf middleware
+func CSRFFailure(w http.ResponseWriter, r *http.Request) {
+	err := apperr.Forbidden("Your session has expired or the request came from another site. Reload the page and try again.")
+	err.Err = csrf.Failure(r)
+	slog.WarnContext(r.Context(), "csrf check failed", "method", r.Method, "path", r.URL.Path, "err", err.Err)
+	respondError(w, r, err)
+}
+
+// RateLimited answers requests rejected by the rate limiter
+func RateLimited(w http.ResponseWriter, r *http.Request) {
+	rejection := ratelimit.RejectionOf(r)
+	metrics.RateLimited.WithLabelValues(rejection.Rule, rejection.Scope).Inc()
+
+	seconds := int(math.Ceil(rejection.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	respondError(w, r, apperr.RateLimited("Too many requests. Try again in %d seconds.", max(seconds, 1)))
+}
+
+// NotFound answers requests that match no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, apperr.NotFound("The page could not be found."))
+}
+
+// Recover turns a panicking handler into an internal error response instead
+// of a dropped connection. Aborted handlers keep panicking, net/http expects
+// that.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			slog.ErrorContext(r.Context(), "panic serving request", "panic", rec, "stack", string(debug.Stack()))
+			respondError(w, r, fmt.Errorf("panic: %v", rec))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
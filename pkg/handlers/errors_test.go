@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/ratelimit"
+)
+
+func TestRateLimited(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Rule{
+		ratelimit.DefaultRule: {IP: ratelimit.Limit{Requests: 2, Per: 3 * time.Second}},
+	})
+	handler := limiter.Middleware(http.HandlerFunc(RateLimited))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	//A token comes back every 1.5s, rounded up to whole seconds
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "2" {
+		t.Errorf("Retry-After %q, want 2", retry)
+	}
+}
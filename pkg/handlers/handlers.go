@@ -1,45 +1,125 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
+	"log/slog"
 	"math"
 	"math/rand"
 	"net/http"
-	"os"
+	"net/mail"
+	"net/url"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bxcodec/faker/v3"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/assets"
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"github.com/snipep/Ecommerce-application/pkg/csrf"
+	"github.com/snipep/Ecommerce-application/pkg/jobs"
+	"github.com/snipep/Ecommerce-application/pkg/metrics"
 	"github.com/snipep/Ecommerce-application/pkg/models"
 	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 )
 
 var (
-	tmpl *template.Template
-	currentCartOrderId uuid.UUID
-	cartItems []models.OrderItem
+	tmpl   *template.Template
+	tracer = otel.Tracer("github.com/snipep/Ecommerce-application/pkg/handlers")
 )
 
 type Handler struct {
-	Repo *repository.Repoitory
+	Repo   *repository.Repoitory
+	Jobs   jobs.Queue
+	Config *config.Config
 }
 
-func NewHandler(repo *repository.Repoitory) *Handler {
+func NewHandler(repo *repository.Repoitory, queue jobs.Queue, cfg *config.Config) *Handler {
 	return &Handler{
-		Repo: repo,
+		Repo:   repo,
+		Jobs:   queue,
+		Config: cfg,
 	}
 }
 
-func init()  {
-	templateDir := "./templates"
-	pattern := filepath.Join(templateDir, "**", "*.html")
-	tmpl = template.Must(template.ParseGlob(pattern))
+// background returns the context for work that must finish even if the
+// client goes away, like queueing jobs for changes that are already committed
+func background(r *http.Request) context.Context {
+	return context.WithoutCancel(r.Context())
+}
+
+// UploadDir holds the uploaded product images, it is served under /static/uploads
+const UploadDir = "static/uploads"
+
+// entryTemplates are the pages each part of the site starts from, and the emails
+var entryTemplates = []string{"homepage", "shoppingCart", "products", "orders", "dashboard", "emailOrderConfirmation", "emailOrderStatus"}
+
+// CheckTemplates fails if the templates of the entry pages aren't loaded
+func CheckTemplates(ctx context.Context) error {
+	if tmpl == nil {
+		return errors.New("templates not parsed")
+	}
+	for _, name := range entryTemplates {
+		if tmpl.Lookup(name) == nil {
+			return fmt.Errorf("template %q not defined", name)
+		}
+	}
+	return nil
+}
+
+// Assets serves the static directory, templates link its files with
+// {{asset "css/admin.css"}}
+var Assets *assets.Manifest
+
+//LoadTemplates parses the templates and indexes the static files of the
+//directory holding both, the server calls it once before serving
+func LoadTemplates(root string) error {
+	manifest, err := assets.Load(filepath.Join(root, "static"))
+	if err != nil {
+		return err
+	}
+
+	pattern := filepath.Join(root, "templates", "**", "*.html")
+	parsed, err := template.New("").Funcs(template.FuncMap{"asset": manifest.URL}).ParseGlob(pattern)
+	if err != nil {
+		return err
+	}
+
+	Assets, tmpl = manifest, parsed
+	return nil
+}
+
+// Templates returns every parsed template, the emails are rendered from them too
+func Templates() *template.Template {
+	return tmpl
+}
+
+// Page is embedded in the data of every full page, the layout templates read it
+type Page struct {
+	CSRFToken string
+	// Title and Description are shown in search results, the store name
+	// stands in for an empty title
+	Title        string
+	Description  string
+	CanonicalURL string
+	// Robots is the robots meta tag, e.g. noindex for pages of one visitor
+	Robots string
+	// StructuredData is rendered as JSON-LD
+	StructuredData any
+}
+
+func newPage(r *http.Request) Page {
+	return Page{CSRFToken: csrf.Token(r)}
 }
 
 type ProductCRUDTemplatData struct {
@@ -47,12 +127,25 @@ type ProductCRUDTemplatData struct {
 	Product *models.Product 
 }
 
-func sendProductMessage(w http.ResponseWriter, message []string, product *models.Product)  {
+func sendProductMessage(w http.ResponseWriter, r *http.Request, message []string, product *models.Product)  {
 	data := ProductCRUDTemplatData{
 		Messages: message,
 		Product: product,
 	}
-	tmpl.ExecuteTemplate(w, "messages", data)
+	render(w, r, "messages", data)
+}
+
+//render executes a template in its own span, so slow rendering shows up in
+//traces next to the queries of the request
+func render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	ctx, span := tracer.Start(r.Context(), "render "+name)
+	defer span.End()
+
+	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.ErrorContext(ctx, "rendering template", "template", name, "err", err)
+	}
 }
 
 func makeRange(min, max int) []int {
@@ -73,6 +166,7 @@ func (h *Handler) SeedProduct(w http.ResponseWriter, r *http.Request)  {
 	// An array of realistic product names to puck from 
 	productTypes := []string{"Laptop", "Smartphone", "Tablet", "Headphone", "Speaker", "Camera", "TV", "Watch", "Printer", "Monitor"}
 
+	ctx := h.audited(r, AuditProductSeed)
 	for i := 0; i < numProducts; i++ {
 		//Generate the random but more realistic product type
 		productType := productTypes[rand.Intn(len(productTypes))]
@@ -82,11 +176,11 @@ func (h *Handler) SeedProduct(w http.ResponseWriter, r *http.Request)  {
 			ProductName: productName,
 			Price: float64(rand.Intn(100000))/100,
 			Description: faker.Sentence(),
-			ProductImage: "placeholder.jpg",
+			ProductImage: models.PlaceholderImage,
 		}
-		err := h.Repo.Product.CreateProduct(&product)
+		err := h.Repo.Product.CreateProduct(ctx, &product)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error creating product %s:%v", product.ProductName, err), http.StatusInternalServerError)
+			respondError(w, r, fmt.Errorf("seeding product %s: %w", product.ProductName, err))
 			return 
 		}
 	}
@@ -95,39 +189,78 @@ func (h *Handler) SeedProduct(w http.ResponseWriter, r *http.Request)  {
 		fmt.Fprintf(w, "Successfully seeded %d dummy products", numProducts)
 }
 
+// productColumns are the sortable columns of the admin product table
+var productColumns = [][2]string{
+	{"name", "Name"},
+	{"category", "Category"},
+	{"price", "Price"},
+	{"created", "Created"},
+}
+
+type ProductListView struct {
+	Page
+	ListView
+	Categories []string
+}
+
+func (h *Handler) newProductListView(ctx context.Context, params url.Values) ProductListView {
+	categories, err := h.Repo.Product.ListCategories(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing categories", "err", err)
+	}
+
+	return ProductListView{
+		ListView:   newListView(params, productColumns),
+		Categories: categories,
+	}
+}
+
 func (h *Handler) ProductPage(w http.ResponseWriter, r *http.Request)  {
-	tmpl.ExecuteTemplate(w, "products", nil)
+	view := h.newProductListView(r.Context(), r.URL.Query())
+	view.Page = newPage(r)
+	render(w, r, "products", view)
 }
 
 func (h *Handler) AllProductsView(w http.ResponseWriter, r *http.Request)  {
-	tmpl.ExecuteTemplate(w, "allProducts", nil)
+	render(w, r, "allProducts", h.newProductListView(r.Context(), r.URL.Query()))
 }
 
-func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request)  {
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+func parseProductFilter(params url.Values) repository.ProductFilter {
+	filter := repository.ProductFilter{
+		Name:     strings.TrimSpace(params.Get("q")),
+		Category: params.Get("category"),
+		MinPrice: parseOptionalFloat(params.Get("min_price")),
+		MaxPrice: parseOptionalFloat(params.Get("max_price")),
+		DateFrom: parseDate(params.Get("from")),
+		Archived: params.Get("archived"),
+		SortBy:   params.Get("sort"),
+		SortDesc: params.Get("dir") == "desc",
 	}
-	
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 10		//Default limit
+
+	//The "to" date is inclusive
+	if to := parseDate(params.Get("to")); !to.IsZero() {
+		filter.DateTo = to.AddDate(0, 0, 1)
 	}
+	return filter
+}
 
-	offset := (page - 1) * limit
+func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request)  {
+	params := r.URL.Query()
+	page, limit := parsePaging(params)
 
-	products, err := h.Repo.Product.ListProducts(limit, offset)
+	filter := parseProductFilter(params)
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	products, err := h.Repo.Product.SearchProducts(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
 
-	totalProducts, err := h.Repo.Product.GetTotalProductsCount()
+	totalProducts, err := h.Repo.Product.CountProducts(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
 
@@ -137,6 +270,7 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request)  {
 	pageButtonsRange := makeRange(1, totalPage)
 
 	data := struct {
+		ListView
 		Products 			[]models.Product
 		CurrentPage			int
 		TotalPages			int
@@ -145,6 +279,7 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request)  {
 		NextPage 			int
 		PageButtonsRange 	[]int
 	}{
+		ListView: 			newListView(params, productColumns),
 		Products: 			products,
 		CurrentPage: 		page,
 		TotalPages: 		totalPage,
@@ -154,35 +289,111 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request)  {
 		PageButtonsRange: 	pageButtonsRange,
 	}
 
-	//Fake latency
-	// time.Sleep(3 * time.Second)
+	//Keep the filters in the address bar so the filtered view can be bookmarked
+	if r.Header.Get("HX-Request") == "true" {
+		pushURL := "/manageproducts"
+		if query := cleanParams(params).Encode(); query != "" {
+			pushURL += "?" + query
+		}
+		w.Header().Set("HX-Push-Url", pushURL)
+	}
+
+	render(w, r, "productRows", data)
+}
+
+// BulkProducts applies one action to every product ticked in the product table
+func (h *Handler) BulkProducts(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		badRequest(w, r, "The form could not be read.")
+		return
+	}
+
+	var productIDs []uuid.UUID
+	for _, value := range r.PostForm["product_ids"] {
+		productID, err := uuid.Parse(value)
+		if err != nil {
+			sendProductMessage(w, r, []string{"Invalid product ID " + value}, nil)
+			return
+		}
+		productIDs = append(productIDs, productID)
+	}
+	if len(productIDs) == 0 {
+		sendProductMessage(w, r, []string{"Select at least one product"}, nil)
+		return
+	}
+
+	action := repository.BulkAction{
+		Action:   r.FormValue("action"),
+		Category: strings.TrimSpace(r.FormValue("category")),
+	}
+	if action.Action == repository.BulkPrice {
+		percent, err := strconv.ParseFloat(r.FormValue("percent"), 64)
+		if err != nil {
+			sendProductMessage(w, r, []string{"Enter the price change as a percentage"}, nil)
+			return
+		}
+		action.Percent = percent
+	}
+
+	results, err := h.Repo.Product.BulkUpdate(h.audited(r, "product.bulk_"+action.Action), productIDs, action)
+	if err != nil && !errors.Is(err, repository.ErrBulkRolledBack) {
+		respondError(w, r, err)
+		return
+	}
+
+	var responseMessage []string
+	for _, result := range results {
+		name := result.Product.ProductName
+		if name == "" {
+			name = result.ProductID.String()
+		}
+		if result.Err != nil {
+			responseMessage = append(responseMessage, name+": failed, "+apperr.Message(result.Err))
+		} else {
+			responseMessage = append(responseMessage, name+": "+result.Message)
+		}
+	}
+
+	if err != nil {
+		responseMessage = append([]string{"No changes were saved because some products could not be updated."}, responseMessage...)
+		sendProductMessage(w, r, responseMessage, nil)
+		return
+	}
+
+	if action.Action == repository.BulkDelete {
+		for _, result := range results {
+			h.removeProductImages(r, &result.Product)
+		}
+	}
 
-	tmpl.ExecuteTemplate(w, "productRows", data)
+	//Reload the product table to reflect the changes
+	w.Header().Set("HX-Trigger", "productsChanged")
+	sendProductMessage(w, r, responseMessage, nil)
 }
 
 func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request)  {
 	vars := mux.Vars(r)
 	productID, err := uuid.Parse(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid product ID.")
 		return 
 	}
 
-	product, err := h.Repo.Product.GetProductByID(productID)
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
-	tmpl.ExecuteTemplate(w, "viewProduct", product)
+	render(w, r, "viewProduct", product)
 }
 
 func (h Handler) CreatePoductView(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "createProduct", nil)
+	render(w, r, "createProduct", nil)
 }
 
 func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	//Parse the multipart form, 10MB max upload size
-	r.ParseMultipartForm(10 << 20)
+	r.ParseMultipartForm(MaxImageUpload)
 
 	// Initialize error messagees slice
 	var responseMessage []string
@@ -191,17 +402,18 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	ProductName := r.FormValue("product_name")
 	ProductPrice := r.FormValue("price")
 	ProductDescription := r.FormValue("description")
+	ProductSKU := strings.TrimSpace(r.FormValue("sku"))
 
 	if ProductName == "" || ProductPrice == "" || ProductDescription == "" {
 		responseMessage = append(responseMessage, "All field are required")
-		sendProductMessage(w, responseMessage, nil)
+		sendProductMessage(w, r, responseMessage, nil)
 		return
 	}
 
 	/* Process File Upload */
 
 	//Retirve the file from the data
-	file, handler, err := r.FormFile("product_image")
+	file, _, err := r.FormFile("product_image")
 	if err != nil{
 		if err == http.ErrMissingFile {
 			responseMessage = append(responseMessage, "Select an image for the product")
@@ -210,44 +422,30 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(responseMessage) > 0 {
-			fmt.Println(responseMessage)
-			sendProductMessage(w, responseMessage, nil)
+			sendProductMessage(w, r, responseMessage, nil)
 			return 
 		}
 	}
 
 	defer file.Close()
 
-	//Generate a unique filename to prevent overwriting and conflict
-	uuid, err := uuid.NewRandom()
-	if err != nil{
-		responseMessage = append(responseMessage, "Error generating new Unique identifier")
-		return 
-	}
-	filename := uuid.String() + filepath.Ext(handler.Filename) // append file extension
-
-	// Create the full path for saving the file 
-	filePath := filepath.Join("static/uploads", filename)
-
-	// Save the file to the sever 
-	dst, err := os.Create(filePath)
+	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
 	if err != nil {
-		responseMessage = append(responseMessage, "Error saving the file")
-		sendProductMessage(w, responseMessage, nil)
+		responseMessage = append(responseMessage, "invalid price")
+		sendProductMessage(w, r, responseMessage, nil)
 		return 
 	}
 
-	defer dst.Close()
-	if _, err = io.Copy(dst, file);err != nil{
-		responseMessage = append(responseMessage, "Error saving the file")
-		sendProductMessage(w, responseMessage, nil)
-		return 
+	// Save the file to the sever under a unique name
+	filename, err := saveProductImage(file)
+	if errors.Is(err, errNotAnImage) {
+		sendProductMessage(w, r, []string{apperr.Message(err)}, nil)
+		return
 	}
-
-	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
 	if err != nil {
-		responseMessage = append(responseMessage, "invalid price")
-		sendProductMessage(w, responseMessage, nil)
+		slog.ErrorContext(r.Context(), "saving product image", "err", err)
+		responseMessage = append(responseMessage, "Error saving the file")
+		sendProductMessage(w, r, responseMessage, nil)
 		return 
 	}
 
@@ -255,47 +453,60 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		ProductName: ProductName,
 		Price: price,
 		Description: ProductDescription,
+		SKU: ProductSKU,
 		ProductImage: filename,
 	}
 
-	err = h.Repo.Product.CreateProduct(&product)
+	err = h.Repo.Product.CreateProduct(h.audited(r, AuditProductCreate), &product)
 	if err != nil {
-		responseMessage = append(responseMessage, "Invalid price" + err.Error())
-		sendProductMessage(w, responseMessage, nil)
+		removeProductImage(r, filename)
+		respondError(w, r, err)
 		return 
 	}
 
-	// Fake latency 
-	time.Sleep(2 * time.Second)
+	//Resize the uploaded image in the background
+	if err := h.Jobs.Enqueue(background(r), jobs.JobProcessProductImage, jobs.ImagePayload{Filename: filename}); err != nil {
+		slog.ErrorContext(r.Context(), "queueing image processing", "err", err)
+	}
 
-	sendProductMessage(w, []string{}, &product)
+	sendProductMessage(w, r, []string{}, &product)
 }
 
 func (h *Handler) EditProductView(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID, err := uuid.Parse(vars["id"])
 	if err != nil{
-		http.Error(w, "Invalid Product ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid product ID.")
 		return 
 	}
-	product, err := h.Repo.Product.GetProductByID(productID)
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
 	if err != nil{
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
+		return
 	}
-	tmpl.ExecuteTemplate(w, "editProduct", product)
+	data := struct {
+		*models.Product
+		Gallery ProductImagesView
+	}{
+		Product: product,
+		Gallery: ProductImagesView{Product: product, Max: repository.MaxProductImages},
+	}
+	render(w, r, "editProduct", data)
 }
 
 func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID, err := uuid.Parse(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid product ID.")
 		return 
 	}
 
-	err = r.ParseForm()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	//The form is multipart when it replaces the image
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImageUpload+1<<20)
+	err = r.ParseMultipartForm(MaxImageUpload)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		badRequest(w, r, "The form could not be read, images can be at most 10MB.")
 		return
 	}
 
@@ -306,17 +517,25 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	ProductName := r.FormValue("product_name")
 	ProductPrice := r.FormValue("price")
 	ProductDescription := r.FormValue("description")
+	ProductSKU := strings.TrimSpace(r.FormValue("sku"))
 
 	if ProductName == "" || ProductPrice == "" || ProductDescription == "" {
 		responseMessage = append(responseMessage, "All field are required")
-		sendProductMessage(w, responseMessage, nil)
+		sendProductMessage(w, r, responseMessage, nil)
 		return
 	}
 
 	price, err := strconv.ParseFloat(ProductPrice, 64)
 	if err != nil {
 		responseMessage = append(responseMessage, "Invalid Price")
-		sendProductMessage(w, responseMessage, nil)
+		sendProductMessage(w, r, responseMessage, nil)
+		return
+	}
+
+	//The version the form was loaded at, to detect edits made in the meantime
+	version, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil {
+		badRequest(w, r, "The form is out of date, reload the product and try again.")
 		return
 	}
 
@@ -325,69 +544,255 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		ProductName: ProductName,
 		Price: price,
 		Description: ProductDescription,
+		SKU: ProductSKU,
+		Version: version,
 	}
 
-	err = h.Repo.Product.UpdateProduct(&product)
+	//Keep the product as it was to remove its image. It must be the version the form was based on, the update only replaces
+	//that version, so previous is exactly what the update overwrites.
+	previous, err := h.Repo.Product.GetProductByID(r.Context(), productID)
 	if err != nil {
-		responseMessage = append(responseMessage, "Invalid price" + err.Error())
-		sendProductMessage(w, responseMessage, nil)
+		respondError(w, r, err)
+		return
+	}
+	if previous.Version != version {
+		productConflict(w, r, product, *previous)
+		return
+	}
+
+	//A new image is saved under a new name, the old one stays in place
+	//until the update is committed
+	file, _, err := r.FormFile("product_image")
+	if err == nil {
+		defer file.Close()
+		product.ProductImage, err = saveProductImage(file)
+		if errors.Is(err, errNotAnImage) {
+			sendProductMessage(w, r, []string{apperr.Message(err)}, nil)
+			return
+		}
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+	} else if !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		badRequest(w, r, "The image could not be read.")
+		return
+	}
+
+	err = h.Repo.Product.UpdateProduct(h.audited(r, AuditProductUpdate), &product)
+	if err != nil && product.ProductImage != "" {
+		removeProductImage(r, product.ProductImage)
+	}
+	var stale *repository.StaleProductError
+	if errors.As(err, &stale) {
+		productConflict(w, r, product, stale.Current)
+		return
+	}
+	if err != nil {
+		respondError(w, r, err)
 		return 
 	}
 
+	//previous is the version the update replaced, so it holds the old image
+	if product.ProductImage != "" {
+		if err := h.Jobs.Enqueue(background(r), jobs.JobProcessProductImage, jobs.ImagePayload{Filename: product.ProductImage}); err != nil {
+			slog.ErrorContext(r.Context(), "queueing image processing", "err", err)
+		}
+		if err := h.Jobs.Enqueue(background(r), jobs.JobDeleteProductImage, jobs.ImagePayload{Filename: previous.ProductImage}); err != nil {
+			slog.ErrorContext(r.Context(), "queueing image removal", "err", err)
+		}
+	}
+
 	//Get and send updated product
-	updatedProduct, _ := h.Repo.Product.GetProductByID(productID)
+	updatedProduct, err := h.Repo.Product.GetProductByID(r.Context(), productID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
 
-	// Fake latency 
-	time.Sleep(2 * time.Second)
+	sendProductMessage(w, r, []string{}, updatedProduct)
+}
 
-	sendProductMessage(w, []string{}, updatedProduct)
+// ConflictField is a product field as the admin submitted it and as it is saved
+type ConflictField struct {
+	Name      string
+	Label     string
+	Yours     string
+	Saved     string
+	Multiline bool
+}
+
+// ProductConflictView shows an edit that was based on an older version of
+// Saved next to the saved values, so the admin can merge them and save again
+type ProductConflictView struct {
+	Saved  models.Product
+	Fields []ConflictField
+}
+
+// productConflict replaces the edit form with one holding both versions
+func productConflict(w http.ResponseWriter, r *http.Request, yours, saved models.Product) {
+	formatPrice := func(price float64) string {
+		return strconv.FormatFloat(price, 'f', -1, 64)
+	}
+
+	view := ProductConflictView{
+		Saved: saved,
+		Fields: []ConflictField{
+			{Name: "product_name", Label: "Name", Yours: yours.ProductName, Saved: saved.ProductName},
+			{Name: "sku", Label: "SKU", Yours: yours.SKU, Saved: saved.SKU},
+			{Name: "price", Label: "Price", Yours: formatPrice(yours.Price), Saved: formatPrice(saved.Price)},
+			{Name: "description", Label: "Description", Yours: yours.Description, Saved: saved.Description, Multiline: true},
+		},
+	}
+
+	w.Header().Set("HX-Retarget", "#productPagesContainer")
+	w.Header().Set("HX-Reswap", "innerHTML")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	render(w, r, "productConflict", view)
+}
+
+//removeProductImages deletes the main image and gallery of a deleted product in the background
+func (h *Handler) removeProductImages(r *http.Request, product *models.Product) {
+	for _, image := range append([]string{product.ProductImage}, product.Images...) {
+		if err := h.Jobs.Enqueue(background(r), jobs.JobDeleteProductImage, jobs.ImagePayload{Filename: image}); err != nil {
+			slog.ErrorContext(r.Context(), "queueing image removal", "err", err)
+		}
+	}
 }
 
 func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID, err := uuid.Parse(vars["id"])
 	if err != nil{
-		http.Error(w, "Invalid Product id", http.StatusBadRequest)
+		badRequest(w, r, "Invalid product ID.")
+		return
+	}
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
+	if err != nil {
+		respondError(w, r, err)
 		return
 	}
-	product, _ := h.Repo.Product.GetProductByID(productID)
 
-	err = h.Repo.Product.DeleteProduct(productID)
+	err = h.Repo.Product.DeleteProduct(h.audited(r, AuditProductDelete), productID)
 	if err != nil{
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
 
 	//Remove product image 
-	productImagePath := filepath.Join("/static/upload", product.ProductImage)
-	os.Remove(productImagePath)
+	h.removeProductImages(r, product)
+
+	render(w, r, "allProducts", h.newProductListView(r.Context(), nil))
+}
 
-	// Fake latency 
-	time.Sleep(2 * time.Second)
+// CartCookie holds the ID of the visitor's cart
+const CartCookie = "cart_id"
 
-	tmpl.ExecuteTemplate(w, "allProducts", nil)
+// cartID returns the cart of the visitor, starting a new one if they don't have one yet
+func cartID(w http.ResponseWriter, r *http.Request) uuid.UUID {
+	if cookie, err := r.Cookie(CartCookie); err == nil {
+		if id, err := uuid.Parse(cookie.Value); err == nil {
+			return id
+		}
+	}
+
+	id := uuid.New()
+	http.SetCookie(w, &http.Cookie{
+		Name:     CartCookie,
+		Value:    id.String(),
+		Path:     "/",
+		MaxAge:   30 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
 }
 
 func (h *Handler) ShoppingHomepage(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cartID(w, r))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	storefront, err := h.storefront(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	//Every page and order lists the same catalog, only the first is indexed
+	page := h.seoPage(r, "", "Shop the full catalog of "+h.Config.Store.Name+" and check out in a few clicks.", "/")
+	if storefront.Paged {
+		page.Robots = "noindex, follow"
+	}
+
 	data := struct{
+		Page
 		OrderItems []models.OrderItem
+		Storefront StorefrontView
 	}{
+		Page: page,
 		OrderItems: cartItems,
+		Storefront: storefront,
 	}
 
-	tmpl.ExecuteTemplate(w, "homepage", data)
+	render(w, r, "homepage", data)
 }
 
-func (h *Handler) ShoppingItemView(w http.ResponseWriter, r *http.Request) {
-	// fake latency 
-	time.Sleep(2 * time.Second)
+// ProductDetail is the storefront page of a product. Old slugs of renamed
+// products redirect to the current one.
+func (h *Handler) ProductDetail(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	product, err := h.Repo.Product.GetProductBySlug(r.Context(), slug)
+	if err == nil && product.Archived {
+		err = repository.ErrProductNotFound
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if product.Slug != slug {
+		http.Redirect(w, r, productPath(product), http.StatusMovedPermanently)
+		return
+	}
+
+	page := h.seoPage(r, product.ProductName, product.Description, productPath(product))
+	page.StructuredData = h.productStructuredData(product)
+
+	data := struct {
+		Page
+		Product *models.Product
+	}{
+		Page:    page,
+		Product: product,
+	}
 
-	products, _ := h.Repo.Product.GetProducts("product_image !=''")
+	render(w, r, "productPage", data)
+}
 
-	tmpl.ExecuteTemplate(w, "shoppingItems", products)
+// ShoppingItemView renders the next page of the storefront for the infinite
+// scroll of the homepage
+func (h *Handler) ShoppingItemView(w http.ResponseWriter, r *http.Request) {
+	storefront, err := h.storefront(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	render(w, r, "shoppingItems", storefront)
 }
 
 func (h *Handler) CartView(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cartID(w, r))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
 	data := struct{
 		OrderItems []models.OrderItem
 		Message string
@@ -397,13 +802,13 @@ func (h *Handler) CartView(w http.ResponseWriter, r *http.Request) {
 		OrderItems: cartItems,
 		Message: "",
 		AlertType: "",
-		TotalCost: getTotalCartCost(),
+		TotalCost: getTotalCartCost(cartItems),
 	}
 
-	tmpl.ExecuteTemplate(w, "cartItems", data)
+	render(w, r, "cartItems", data)
 }
 
-func getTotalCartCost() float64 {
+func getTotalCartCost(cartItems []models.OrderItem) float64 {
 	totaCost := 0.0
 	for _, item := range cartItems {
 		totaCost += float64(item.Quantity) * item.Product.Price
@@ -416,43 +821,31 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID, err := uuid.Parse(vars["product_id"])
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
-		fmt.Println("failedd bruhh")
+		badRequest(w, r, "Invalid product ID.")
 		return 
 	}
 
-	//Generate a new order id for the session if one does not exist
-	if currentCartOrderId == uuid.Nil {
-		currentCartOrderId = uuid.New()
-	}
+	cart := cartID(w, r)
 
-	//Check if profuct already exist in order items
-	exist := false
-	for _, item := range cartItems{
-		if item.ProductID == productID{
-			exist = true
-			break
-		}
+	// Get the Product 
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
+	if err != nil {
+		respondError(w, r, err)
+		return
 	}
 
-	// Get the Product 
-	product, _ := h.Repo.Product.GetProductByID(productID)
+	//Add the product unless it is already in the cart
+	added, err := h.Repo.Cart.AddItem(r.Context(), cart, productID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
 
 	cartMessage := ""
 	alertType := ""
 
-	if !exist {
-		//Create a new order item
-		newOrderItem := models.OrderItem{
-			OrderID: currentCartOrderId,
-			ProductID: productID,
-			Quantity: 1,
-			Product: *product,
-		}	 
-
-		// Add new order item to the array 
-		cartItems = append(cartItems, newOrderItem)
-
+	if added {
+		metrics.CartAdds.Inc()
 		cartMessage = product.ProductName + " successfully added"
 		alertType = "Success"
 	}else {
@@ -460,6 +853,12 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		alertType = "danger"
 	}
 
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cart)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
 	data := struct {
 		OrderItems []models.OrderItem
 		Message string
@@ -469,14 +868,20 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		OrderItems: cartItems,
 		Message: cartMessage,
 		AlertType: alertType,
-		TotalCost: getTotalCartCost(),
+		TotalCost: getTotalCartCost(cartItems),
 	}
 
-	tmpl.ExecuteTemplate(w,  "cartItems", data)
+	render(w, r, "cartItems", data)
 }
 
 func (h *Handler) ShoppingCartView(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "shoppingCart", cartItems)
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cartID(w, r))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	render(w, r, "shoppingCart", cartItems)
 }
 
 func (h *Handler) UpdateorderItemQuantity(w http.ResponseWriter, r *http.Request) {
@@ -486,13 +891,20 @@ func (h *Handler) UpdateorderItemQuantity(w http.ResponseWriter, r *http.Request
 
 	productID, err := uuid.Parse(r.URL.Query().Get("product_id"))
 	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid product ID.")
 		return 
 	}
 	action := r.URL.Query().Get("action")
 
+	cart := cartID(w, r)
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cart)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
 	// Find the order item 
-	var itemIndex int
+	itemIndex := -1
 	for i, item := range cartItems {
 		if item.ProductID == productID {
 			itemIndex = i
@@ -500,24 +912,24 @@ func (h *Handler) UpdateorderItemQuantity(w http.ResponseWriter, r *http.Request
 		}
 	}
 	if itemIndex == -1 {
-		http.Error(w, "Product not found in order", http.StatusNotFound)
+		respondError(w, r, apperr.NotFound("The product is not in your cart."))
 		return 
 	}
 
 	//Update quantitiy based on action
+	quantity := cartItems[itemIndex].Quantity
 	switch action {
 	case "add":
-		cartItems[itemIndex].Quantity++
+		quantity++
 	case "subtract":
-		cartItems[itemIndex].Quantity--
+		quantity--
 		//Remove item if quantity gets to 0
-		if cartItems[itemIndex].Quantity == 0 {
-			cartItems = append(cartItems[:itemIndex], cartItems[itemIndex + 1:]...)
+		if quantity == 0 {
 			refreshCartList = true
 		}
 	case "remove":
 		//Remove item regarless of the quantity
-		cartItems = append(cartItems[ : itemIndex], cartItems[itemIndex + 1 : ]...)
+		quantity = 0
 		refreshCartList = true
 	default:
 		/* http.Error(w, "Invaliud action", http.StatusBadRequest)
@@ -525,6 +937,17 @@ func (h *Handler) UpdateorderItemQuantity(w http.ResponseWriter, r *http.Request
 		cartMessage = "Invalid Action"
 	}
 
+	if quantity != cartItems[itemIndex].Quantity {
+		if err := h.Repo.Cart.SetQuantity(r.Context(), cart, productID, quantity); err != nil {
+			respondError(w, r, err)
+			return
+		}
+		if cartItems, err = h.Repo.Cart.GetCart(r.Context(), cart); err != nil {
+			respondError(w, r, err)
+			return
+		}
+	}
+
 	//Respond to teh request
 	//fmt.Fprintf(w, "Order item updated")
 	data := struct {
@@ -538,86 +961,200 @@ func (h *Handler) UpdateorderItemQuantity(w http.ResponseWriter, r *http.Request
 		OrderItems: cartItems,
 		Message: cartMessage,
 		AlertType: "info",
-		TotalCost: getTotalCartCost(),
+		TotalCost: getTotalCartCost(cartItems),
 		Action: action,
 		RefreshCartItems: refreshCartList,
 	}
 
-	tmpl.ExecuteTemplate(w, "updateShoppingCart", data)
+	render(w, r, "updateShoppingCart", data)
+}
+
+// maxEmailLength is the longest address SMTP can deliver to
+const maxEmailLength = 254
+
+//The longest name and billing address the orders table holds
+const (
+	maxCustomerNameLength = 255
+	maxBillingAddressLength = 500
+)
+
+// parseCustomer reads and checks the details entered at checkout
+func parseCustomer(r *http.Request) (models.Customer, error) {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if email == "" {
+		return models.Customer{}, apperr.Validation("Enter your email address so we can send you the order confirmation.")
+	}
+	//Only a bare address, not a name with an address in angle brackets
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > maxEmailLength || !strings.Contains(email[strings.LastIndexByte(email, '@'):], ".") {
+		return models.Customer{}, apperr.Validation("%q is not a valid email address.", email)
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" {
+		return models.Customer{}, apperr.Validation("Enter the name to put on the invoice.")
+	}
+	if utf8.RuneCountInString(name) > maxCustomerNameLength {
+		return models.Customer{}, apperr.Validation("The name must be at most %d characters.", maxCustomerNameLength)
+	}
+
+	//Browsers send textarea line breaks as CRLF
+	billing := strings.TrimSpace(strings.ReplaceAll(r.PostFormValue("address"), "\r\n", "\n"))
+	if billing == "" {
+		return models.Customer{}, apperr.Validation("Enter your billing address.")
+	}
+	if utf8.RuneCountInString(billing) > maxBillingAddressLength {
+		return models.Customer{}, apperr.Validation("The billing address must be at most %d characters.", maxBillingAddressLength)
+	}
+
+	return models.Customer{Email: email, Name: name, Address: billing}, nil
 }
 
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
+	customer, err := parseCustomer(r)
+	if err != nil {
+		metrics.CheckoutFailures.WithLabelValues(metrics.ReasonInvalid).Inc()
+		respondError(w, r, err)
+		return
+	}
+
+	cart := cartID(w, r)
+	cartItems, err := h.Repo.Cart.GetCart(r.Context(), cart)
+	if err != nil {
+		metrics.CheckoutFailures.WithLabelValues(metrics.ReasonError).Inc()
+		respondError(w, r, err)
+		return
+	}
+	if len(cartItems) == 0 {
+		metrics.CheckoutFailures.WithLabelValues(metrics.ReasonEmptyCart).Inc()
+		badRequest(w, r, "Your cart is empty.")
+		return
+	}
+
 	for i := range cartItems{
 		cartItems[i].Cost = float64(cartItems[i].Quantity) * cartItems[i].Product.Price
 	}
 
-	err := h.Repo.Order.PlaceOrderWithItems(cartItems)
+	order, err := h.Repo.Order.PlaceOrderWithItems(r.Context(), customer, cartItems)
 	if err != nil{
-		http.Error(w, "Error Placing Order " + err.Error(), http.StatusBadRequest)
+		metrics.CheckoutFailures.WithLabelValues(metrics.ReasonError).Inc()
+		respondError(w, r, err)
 		return 
 	}
+	metrics.OrdersPlaced.Inc()
 
-	displayItems := cartItems
-	totalCost := getTotalCartCost()
+	//The invoice is issued with the order, so downloading it never changes anything
+	if _, err := h.issueInvoice(background(r), order); err != nil {
+		slog.ErrorContext(r.Context(), "issuing invoice", "order_id", order.OrderID, "err", err)
+	}
+
+	// The order is already committed, so a failure to queue the email must not fail the request
+	if err := h.Jobs.Enqueue(background(r), jobs.JobSendOrderConfirmation, jobs.OrderPayload{OrderID: order.OrderID}); err != nil {
+		slog.ErrorContext(r.Context(), "queueing order confirmation", "err", err)
+	}
 
 	//Empty the cart items
-	cartItems = []models.OrderItem{}
-	currentCartOrderId = uuid.Nil
+	if err := h.Repo.Cart.ClearCart(r.Context(), cart); err != nil {
+		slog.ErrorContext(r.Context(), "clearing cart", "err", err)
+	}
+
+	page := newPage(r)
+	page.Title = "Order complete | " + h.Config.Store.Name
+	page.Robots = "noindex"
 
 	data := struct {
+		Page
+		Customer models.Customer
 		OrderItems []models.OrderItem
 		TotalCost float64
 	}{
-		OrderItems: displayItems,
-		TotalCost: totalCost,
+		Page: page,
+		Customer: customer,
+		OrderItems: cartItems,
+		TotalCost: getTotalCartCost(cartItems),
 	}
 
-	tmpl.ExecuteTemplate(w, "orderComplete", data)
+	render(w, r, "orderComplete", data)
+}
+
+// orderColumns are the sortable columns of the admin order table
+var orderColumns = [][2]string{
+	{"customer", "Customer"},
+	{"status", "Order Status"},
+	{"date", "Order Date"},
+	{"total", "Total"},
+}
+
+type OrderListView struct {
+	Page
+	ListView
+	Statuses []string
+}
+
+func newOrderListView(r *http.Request) OrderListView {
+	return OrderListView{
+		ListView: newListView(r.URL.Query(), orderColumns),
+		Statuses: orderStatuses,
+	}
 }
 
 func (h *Handler) OrdersPage(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "orders", nil)
+	view := newOrderListView(r)
+	view.Page = newPage(r)
+	render(w, r, "orders", view)
 }
 
 func (h *Handler) AllordersView(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "allOrders", nil)
+	render(w, r, "allOrders", newOrderListView(r))
 }
 
-func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1{
-		page = 1
+func parseOrderFilter(params url.Values) repository.OrderFilter {
+	filter := repository.OrderFilter{
+		Status:   params.Get("status"),
+		Customer: strings.TrimSpace(params.Get("customer")),
+		Search:   strings.TrimSpace(params.Get("q")),
+		DateFrom: parseDate(params.Get("from")),
+		MinTotal: parseOptionalFloat(params.Get("min_total")),
+		MaxTotal: parseOptionalFloat(params.Get("max_total")),
+		SortBy:   params.Get("sort"),
+		SortDesc: params.Get("dir") == "desc",
 	}
-	
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 10 //default
+
+	//The "to" date is inclusive
+	if to := parseDate(params.Get("to")); !to.IsZero() {
+		filter.DateTo = to.AddDate(0, 0, 1)
 	}
-	
-	offset := (page - 1) * limit
+	return filter
+}
 
-	orders, err := h.Repo.Order.ListOrders(limit, offset)
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	page, limit := parsePaging(params)
+
+	filter := parseOrderFilter(params)
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	orders, err := h.Repo.Order.SearchOrders(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
-	totalOrders, err := h.Repo.Order.GetToatlOrdersCount()
+	totalOrders, err := h.Repo.Order.CountOrders(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, err)
 		return 
 	}
 
-
 	totalPages := int(math.Ceil(float64(totalOrders) / float64(limit)))
 	previousPage := page - 1
 	nextPage := page + 1
 	pageButtonsRange := makeRange(1, totalPages)
 
 	data := struct {
+		ListView
 		Orders           []models.Order
+		TotalOrders      int
 		CurrentPage      int
 		TotalPages       int
 		Limit            int
@@ -625,7 +1162,9 @@ func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
 		NextPage         int
 		PageButtonsRange []int
 	}{
+		ListView:         newListView(params, orderColumns),
 		Orders:           orders,
+		TotalOrders:      totalOrders,
 		CurrentPage:      page,
 		TotalPages:       totalPages,
 		Limit:            limit,
@@ -634,43 +1173,90 @@ func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
 		PageButtonsRange: pageButtonsRange,
 	}
 
-	// Fake latency
-	// time.Sleep(2 * time.Second) 
+	//Keep the filters in the address bar so the filtered view can be bookmarked
+	if r.Header.Get("HX-Request") == "true" {
+		pushURL := "/manageorders"
+		if query := cleanParams(params).Encode(); query != "" {
+			pushURL += "?" + query
+		}
+		w.Header().Set("HX-Push-Url", pushURL)
+	}
 
-	tmpl.ExecuteTemplate(w, "orderRows", data)
+	render(w, r, "orderRows", data)
 }
 
 func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID, err := uuid.Parse(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		badRequest(w, r, "Invalid order ID.")
 		return
 	}
 
-	order, err := h.Repo.Order.GetOrderWithProducts(orderID)
+	order, err := h.Repo.Order.GetOrderWithProducts(r.Context(), orderID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return 
+		respondError(w, r, err)
+		return
+	}
+
+	h.renderOrder(w, r, order)
+}
+
+func (h *Handler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid order ID.")
+		return
 	}
-	
-	totalCost := 0.0 
-	for _, item := range order.Items {
-		totalCost += float64(item.Quantity) * item.Product.Price
+
+	status := r.FormValue("order_status")
+	if !slices.Contains(orderStatuses, status) {
+		badRequest(w, r, "Invalid order status.")
+		return
 	}
 
+	if err := h.Repo.Order.UpdateOrderStatus(h.audited(r, AuditOrderStatus), orderID, status); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	if err := h.Jobs.Enqueue(background(r), jobs.JobSendOrderStatus, jobs.OrderPayload{OrderID: orderID}); err != nil {
+		slog.ErrorContext(r.Context(), "queueing order status email", "err", err)
+	}
+
+	order, err := h.Repo.Order.GetOrderWithProducts(r.Context(), orderID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	h.renderOrder(w, r, order)
+}
+
+// orderStatuses are the statuses an admin can move an order to
+var orderStatuses = []string{"ordered", "out for delivery", "delivered"}
+
+func (h *Handler) renderOrder(w http.ResponseWriter, r *http.Request, order *models.Order) {
 	order.OrderStatus = strings.ToUpper(order.OrderStatus)
 
+	invoice, err := h.Repo.Invoice.GetInvoiceByOrderID(r.Context(), order.OrderID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		respondError(w, r, err)
+		return
+	}
+
 	data := struct {
 		Order models.Order
 		TotalCost float64
+		Statuses []string
+		Invoice *models.Invoice
 	}{
 		Order: *order,
-		TotalCost: totalCost,
+		TotalCost: order.Total,
+		Statuses: orderStatuses,
+		Invoice: invoice,
 	}
 
-	tmpl.ExecuteTemplate(w, "viewOrder", data)
-
-
-
+	render(w, r, "viewOrder", data)
 }
\ No newline at end of file
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"github.com/snipep/Ecommerce-application/pkg/jobs"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"github.com/snipep/Ecommerce-application/pkg/repository/memory"
+)
+
+// TestMain runs the tests from the repository root, where the server finds
+// its templates and uploads
+func TestMain(m *testing.M) {
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := LoadTemplates("."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeQueue records the jobs handlers enqueue instead of running them
+type fakeQueue struct {
+	mu   sync.Mutex
+	jobs []string
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, jobType string, payload any) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, jobType)
+	return nil
+}
+
+func (q *fakeQueue) has(jobType string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Contains(q.jobs, jobType)
+}
+
+func newTestHandler(t *testing.T) (*Handler, *fakeQueue) {
+	t.Helper()
+	queue := &fakeQueue{}
+	cfg := &config.Config{
+		BaseURL: "http://shop.test",
+		Store:   config.StoreConfig{Name: "Test Store", Currency: "USD", TaxRate: 0.1},
+	}
+	return NewHandler(memory.NewRepository(), queue, cfg), queue
+}
+
+func createProduct(t *testing.T, h *Handler, name string, price float64) *models.Product {
+	t.Helper()
+	product := &models.Product{ProductName: name, Price: price, Description: name + " description", ProductImage: models.PlaceholderImage}
+	if err := h.Repo.Product.CreateProduct(context.Background(), product); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func placeOrder(t *testing.T, h *Handler, product *models.Product) *models.Order {
+	t.Helper()
+	items := []models.OrderItem{{ProductID: product.ProductID, Product: *product, Quantity: 1, Cost: product.Price}}
+	order, err := h.Repo.Order.PlaceOrderWithItems(context.Background(), models.Customer{Email: "ada@example.com"}, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// serve runs handler on r as the router would, with vars as the route variables
+func serve(handler http.HandlerFunc, r *http.Request, vars map[string]string) *httptest.ResponseRecorder {
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func formRequest(method, target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func withCart(r *http.Request, cart uuid.UUID) *http.Request {
+	r.AddCookie(&http.Cookie{Name: CartCookie, Value: cart.String()})
+	return r
+}
+
+func TestPlaceOrder(t *testing.T) {
+	h, queue := newTestHandler(t)
+	product := createProduct(t, h, "Mug", 20)
+	cart := uuid.New()
+
+	w := serve(h.AddToCart, withCart(httptest.NewRequest(http.MethodPost, "/addtocart/"+product.ProductID.String(), nil), cart), map[string]string{"product_id": product.ProductID.String()})
+	if w.Code != http.StatusOK {
+		t.Fatalf("adding to cart: status %d", w.Code)
+	}
+
+	form := url.Values{"email": {"ada@example.com"}, "name": {"Ada Lovelace"}, "address": {"1 Main St\r\nSpringfield"}}
+	w = serve(h.PlaceOrder, withCart(formRequest(http.MethodPost, "/ordercomplete", form), cart), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("placing order: status %d: %s", w.Code, w.Body)
+	}
+
+	orders, err := h.Repo.Order.SearchOrders(context.Background(), repository.OrderFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("got %d orders, want 1", len(orders))
+	}
+	want := models.Customer{Email: "ada@example.com", Name: "Ada Lovelace", Address: "1 Main St\nSpringfield"}
+	if orders[0].Customer != want {
+		t.Errorf("customer = %+v, want %+v", orders[0].Customer, want)
+	}
+
+	invoice, err := h.Repo.Invoice.GetInvoiceByOrderID(context.Background(), orders[0].OrderID)
+	if err != nil {
+		t.Fatalf("the order has no invoice: %v", err)
+	}
+	if invoice.Total != 22 {
+		t.Errorf("invoice total = %v, want 22", invoice.Total)
+	}
+
+	if !queue.has(jobs.JobSendOrderConfirmation) {
+		t.Error("no order confirmation was queued")
+	}
+	items, err := h.Repo.Cart.GetCart(context.Background(), cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("the cart still has %d items", len(items))
+	}
+}
+
+func TestPlaceOrderRejectsInvalidDetails(t *testing.T) {
+	valid := url.Values{"email": {"ada@example.com"}, "name": {"Ada Lovelace"}, "address": {"1 Main St"}}
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"no email", "email", ""},
+		{"invalid email", "email", "Ada <ada@example.com>"},
+		{"no name", "name", "  "},
+		{"no address", "address", ""},
+		{"long address", "address", strings.Repeat("a", maxBillingAddressLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, queue := newTestHandler(t)
+			product := createProduct(t, h, "Mug", 20)
+			cart := uuid.New()
+			if _, err := h.Repo.Cart.AddItem(context.Background(), cart, product.ProductID); err != nil {
+				t.Fatal(err)
+			}
+
+			form := url.Values{}
+			for key, values := range valid {
+				form[key] = values
+			}
+			form.Set(tt.field, tt.value)
+
+			w := serve(h.PlaceOrder, withCart(formRequest(http.MethodPost, "/ordercomplete", form), cart), nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if count, _ := h.Repo.Order.CountOrders(context.Background(), repository.OrderFilter{}); count != 0 {
+				t.Errorf("%d orders were placed", count)
+			}
+			if queue.has(jobs.JobSendOrderConfirmation) {
+				t.Error("a confirmation was queued")
+			}
+		})
+	}
+}
+
+func TestPlaceOrderWithEmptyCart(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	form := url.Values{"email": {"ada@example.com"}, "name": {"Ada Lovelace"}, "address": {"1 Main St"}}
+	w := serve(h.PlaceOrder, withCart(formRequest(http.MethodPost, "/ordercomplete", form), uuid.New()), nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOrderInvoiceIsReadOnly(t *testing.T) {
+	h, _ := newTestHandler(t)
+	order := placeOrder(t, h, createProduct(t, h, "Mug", 20))
+	vars := map[string]string{"id": order.OrderID.String()}
+
+	w := serve(h.OrderInvoice, httptest.NewRequest(http.MethodGet, "/orders/"+order.OrderID.String()+"/invoice.pdf", nil), vars)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("downloading a missing invoice: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if _, err := h.Repo.Invoice.GetInvoiceByOrderID(context.Background(), order.OrderID); err == nil {
+		t.Fatal("downloading the invoice issued it")
+	}
+
+	w = serve(h.IssueOrderInvoice, httptest.NewRequest(http.MethodPost, "/orders/"+order.OrderID.String()+"/invoice", nil), vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("issuing the invoice: status %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(h.OrderInvoice, httptest.NewRequest(http.MethodGet, "/orders/"+order.OrderID.String()+"/invoice.pdf", nil), vars)
+	if w.Code != http.StatusOK {
+		t.Fatalf("downloading the invoice: status %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.HasPrefix(w.Body.String(), "%PDF") {
+		t.Error("the body is not a PDF")
+	}
+}
+
+func TestUpdateProductRejectsStaleVersion(t *testing.T) {
+	h, _ := newTestHandler(t)
+	product := createProduct(t, h, "Mug", 20)
+
+	//Someone else saves the product after the form was loaded
+	changed := *product
+	changed.ProductName = "Cup"
+	if err := h.Repo.Product.UpdateProduct(context.Background(), &changed); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"product_name": {"Mug XL"}, "price": {"25"}, "description": {"Bigger"}, "version": {"1"}}
+	w := serve(h.UpdateProduct, formRequest(http.MethodPut, "/products/"+product.ProductID.String(), form), map[string]string{"id": product.ProductID.String()})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	saved, err := h.Repo.Product.GetProductByID(context.Background(), product.ProductID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ProductName != "Cup" {
+		t.Errorf("the stale update was saved, name = %q", saved.ProductName)
+	}
+}
+
+func TestUpdateOrderStatusIsAudited(t *testing.T) {
+	h, queue := newTestHandler(t)
+	order := placeOrder(t, h, createProduct(t, h, "Mug", 20))
+	vars := map[string]string{"id": order.OrderID.String()}
+
+	r := formRequest(http.MethodPut, "/orders/"+order.OrderID.String()+"/status", url.Values{"order_status": {"shipped"}})
+	if w := serve(h.UpdateOrderStatus, r, vars); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	r = formRequest(http.MethodPut, "/orders/"+order.OrderID.String()+"/status", url.Values{"order_status": {"delivered"}})
+	r.RemoteAddr = "203.0.113.7:4711"
+	if w := serve(h.UpdateOrderStatus, r, vars); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	entries, err := h.Repo.Audit.SearchAudit(context.Background(), repository.AuditFilter{EntityID: order.OrderID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Action != AuditOrderStatus || entry.Actor != "anonymous@203.0.113.7" || entry.RemoteIP != "203.0.113.7" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if !queue.has(jobs.JobSendOrderStatus) {
+		t.Error("no status email was queued")
+	}
+}
+
+func TestProductDetail(t *testing.T) {
+	h, _ := newTestHandler(t)
+	product := createProduct(t, h, "Blue Mug", 20)
+	oldSlug := product.Slug
+
+	renamed := *product
+	renamed.ProductName = "Red Mug"
+	if err := h.Repo.Product.UpdateProduct(context.Background(), &renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(h.ProductDetail, httptest.NewRequest(http.MethodGet, "/p/"+oldSlug, nil), map[string]string{"slug": oldSlug})
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/p/"+renamed.Slug {
+		t.Errorf("old slug: status %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = serve(h.ProductDetail, httptest.NewRequest(http.MethodGet, "/p/"+renamed.Slug, nil), map[string]string{"slug": renamed.Slug})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Red Mug") {
+		t.Errorf("current slug: status %d", w.Code)
+	}
+
+	if _, err := h.Repo.Product.BulkUpdate(context.Background(), []uuid.UUID{product.ProductID}, repository.BulkAction{Action: repository.BulkArchive}); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(h.ProductDetail, httptest.NewRequest(http.MethodGet, "/p/"+renamed.Slug, nil), map[string]string{"slug": renamed.Slug})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("archived product: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+// storefrontPages walks the storefront from query, following NextQuery, or
+// PrevQuery when backwards, and returns the pages in the order visited
+func storefrontPages(t *testing.T, h *Handler, query string, backwards bool) []StorefrontView {
+	t.Helper()
+	var pages []StorefrontView
+	for {
+		view, err := h.storefront(httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, view)
+		if len(pages) > 10 {
+			t.Fatal("the pages never end")
+		}
+		if backwards && !view.HasPrev {
+			return pages
+		}
+		if !backwards && !view.HasNext {
+			return pages
+		}
+		query = string(view.NextQuery)
+		if backwards {
+			query = string(view.PrevQuery)
+		}
+	}
+}
+
+func productIDs(products []models.Product) []uuid.UUID {
+	ids := make([]uuid.UUID, len(products))
+	for i, product := range products {
+		ids[i] = product.ProductID
+	}
+	return ids
+}
+
+func TestStorefrontKeysetPages(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	//Names and prices repeat, so pages split runs of equal sort keys
+	names := []string{"Mug", "Cup", "Bowl", "Plate"}
+	var products []models.Product
+	for i := 0; i < 2*storefrontPageSize+2; i++ {
+		products = append(products, *createProduct(t, h, names[i%len(names)], float64(10+i%3)))
+	}
+	//Products without an image stay off the storefront
+	if err := h.Repo.Product.CreateProduct(context.Background(), &models.Product{ProductName: "Vase", Price: 10, Description: "Vase"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort  string
+		query string
+		//compare orders the products by the sort key alone, equal keys
+		//are ordered by ID in the same direction
+		compare func(a, b models.Product) int
+		desc    bool
+	}{
+		{sort: "newest", compare: func(a, b models.Product) int { return a.DateCreated.Compare(b.DateCreated) }, desc: true},
+		{sort: "price_asc", query: "sort=price_asc", compare: func(a, b models.Product) int { return cmp.Compare(a.Price, b.Price) }},
+		{sort: "price_desc", query: "sort=price_desc", compare: func(a, b models.Product) int { return cmp.Compare(a.Price, b.Price) }, desc: true},
+		{sort: "name", query: "sort=name", compare: func(a, b models.Product) int { return cmp.Compare(a.ProductName, b.ProductName) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			want := slices.Clone(products)
+			slices.SortFunc(want, func(a, b models.Product) int {
+				c := tt.compare(a, b)
+				if c == 0 {
+					c = cmp.Compare(a.ProductID.String(), b.ProductID.String())
+				}
+				if tt.desc {
+					c = -c
+				}
+				return c
+			})
+
+			forward := storefrontPages(t, h, tt.query, false)
+			if len(forward) != 3 {
+				t.Fatalf("%d pages, want 3", len(forward))
+			}
+			var got []models.Product
+			for i, page := range forward {
+				if page.Sort != tt.sort || page.HasPrev != (i > 0) || page.Paged != (i > 0) {
+					t.Errorf("page %d: sort %s, has previous %v, paged %v", i+1, page.Sort, page.HasPrev, page.Paged)
+				}
+				got = append(got, page.Products...)
+			}
+			if !slices.Equal(productIDs(got), productIDs(want)) {
+				t.Fatalf("the pages list\n%v\nwant\n%v", productIDs(got), productIDs(want))
+			}
+
+			//Going back from the last page returns the same pages
+			backward := storefrontPages(t, h, string(forward[2].PrevQuery), true)
+			if len(backward) != 2 {
+				t.Fatalf("%d pages back, want 2", len(backward))
+			}
+			for i, page := range backward {
+				match := forward[1-i]
+				if !slices.Equal(productIDs(page.Products), productIDs(match.Products)) {
+					t.Errorf("page %d going back differs from going forward", 2-i)
+				}
+				if !page.HasNext || page.Sort != tt.sort {
+					t.Errorf("page %d going back: has next %v, sort %s", 2-i, page.HasNext, page.Sort)
+				}
+			}
+		})
+	}
+}
+
+func TestStorefrontRejectsBadCursors(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for i := 0; i < storefrontPageSize+1; i++ {
+		createProduct(t, h, fmt.Sprintf("Mug %d", i), 10)
+	}
+	first, err := h.storefront(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantFirst bool
+	}{
+		{name: "malformed after", query: "after=not-a-uuid", wantFirst: true},
+		{name: "malformed before", query: "before=" + url.QueryEscape("1 OR 1=1"), wantFirst: true},
+		{name: "unknown sort", query: "sort=cheapest", wantFirst: true},
+		{name: "unknown product after", query: "after=" + uuid.NewString()},
+		{name: "unknown product before", query: "before=" + uuid.NewString()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view, err := h.storefront(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantFirst {
+				//Bad parameters are ignored
+				if !slices.Equal(productIDs(view.Products), productIDs(first.Products)) || view.Paged || view.HasPrev || !view.HasNext {
+					t.Errorf("not the first page: %d products, paged %v, has previous %v, has next %v", len(view.Products), view.Paged, view.HasPrev, view.HasNext)
+				}
+				return
+			}
+			//A cursor naming no product lands past either end
+			if len(view.Products) != 0 || view.HasNext || view.HasPrev {
+				t.Errorf("%d products, has next %v, has previous %v", len(view.Products), view.HasNext, view.HasPrev)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/jobs"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"golang.org/x/image/draw"
+)
+
+// MaxImageUpload is the largest product image accepted, in bytes
+const MaxImageUpload = 10 << 20
+
+// previewWidth is the width of the thumbnail shown before an image is saved
+const previewWidth = 300
+
+// imageExtensions maps the formats product images may have to the extension
+// they are saved with
+var imageExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+}
+
+var errNotAnImage = apperr.Validation("Choose a JPEG, PNG or GIF image.")
+
+// imageFormat checks that file is a product image and rewinds it
+func imageFormat(file multipart.File) (string, error) {
+	_, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", errNotAnImage
+	}
+	if _, ok := imageExtensions[format]; !ok {
+		return "", errNotAnImage
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return format, nil
+}
+
+// saveProductImage stores an uploaded image under a new unique name, which
+// it returns. The name never comes from the client.
+func saveProductImage(file multipart.File) (string, error) {
+	format, err := imageFormat(file)
+	if err != nil {
+		return "", err
+	}
+
+	filename := uuid.NewString() + imageExtensions[format]
+	dst, err := os.Create(filepath.Join(UploadDir, filename))
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, file)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return filename, nil
+}
+
+// removeProductImage deletes an image that was saved for a change that was
+// then rejected, so nothing refers to it
+func removeProductImage(r *http.Request, filename string) {
+	if err := os.Remove(filepath.Join(UploadDir, filename)); err != nil {
+		slog.ErrorContext(r.Context(), "removing unused product image", "filename", filename, "err", err)
+	}
+}
+
+// ImagePreview is rendered by the imagePreview template
+type ImagePreview struct {
+	// Source is a data URL of the thumbnail
+	Source template.URL
+	Width  int
+	Height int
+	Size   int64
+	Error  string
+}
+
+// PreviewProductImage shows a thumbnail of the image picked in a product form
+// before it is saved, or why it can't be used
+func (h *Handler) PreviewProductImage(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImageUpload+1<<20)
+	if err := r.ParseMultipartForm(MaxImageUpload); err != nil {
+		render(w, r, "imagePreview", ImagePreview{Error: "The image is larger than 10MB."})
+		return
+	}
+
+	file, header, err := r.FormFile("product_image")
+	if errors.Is(err, http.ErrMissingFile) {
+		render(w, r, "imagePreview", ImagePreview{})
+		return
+	}
+	if err != nil {
+		badRequest(w, r, "The image could not be read.")
+		return
+	}
+	defer file.Close()
+
+	preview, err := previewImage(file)
+	if err != nil {
+		render(w, r, "imagePreview", ImagePreview{Error: apperr.Message(err)})
+		return
+	}
+	preview.Size = header.Size
+	render(w, r, "imagePreview", preview)
+}
+
+func previewImage(file multipart.File) (ImagePreview, error) {
+	if _, err := imageFormat(file); err != nil {
+		return ImagePreview{}, err
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return ImagePreview{}, errNotAnImage
+	}
+
+	bounds := src.Bounds()
+	width := min(bounds.Dx(), previewWidth)
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+	//JPEG has no transparency, so draw onto white like the storefront background
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return ImagePreview{}, err
+	}
+
+	return ImagePreview{
+		//The thumbnail is encoded here, so it is safe to use as a URL
+		Source: template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())),
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}, nil
+}
+
+// SizeText describes the size of the upload for people
+func (p ImagePreview) SizeText() string {
+	if p.Size < 1<<20 {
+		return fmt.Sprintf("%d KB", (p.Size+1023)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(p.Size)/(1<<20))
+}
+
+// ProductImagesView is rendered by the productImages template, the gallery
+// of a product on its edit page
+type ProductImagesView struct {
+	Product  *models.Product
+	Messages []string
+	Max      int
+}
+
+func (h *Handler) renderProductImages(w http.ResponseWriter, r *http.Request, productID uuid.UUID, messages []string) {
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	render(w, r, "productImages", ProductImagesView{Product: product, Messages: messages, Max: repository.MaxProductImages})
+}
+
+// AddProductImages adds the uploaded images to the gallery of a product
+func (h *Handler) AddProductImages(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid product ID.")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, repository.MaxProductImages*MaxImageUpload+1<<20)
+	if err := r.ParseMultipartForm(MaxImageUpload); err != nil {
+		h.renderProductImages(w, r, productID, []string{"The images could not be read, each can be at most 10MB."})
+		return
+	}
+
+	product, err := h.Repo.Product.GetProductByID(r.Context(), productID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	uploads := r.MultipartForm.File["images"]
+	if free := repository.MaxProductImages - len(product.Images); len(uploads) > free {
+		h.renderProductImages(w, r, productID, []string{fmt.Sprintf("Choose at most %d more images, a product can have %d besides its main image.", free, repository.MaxProductImages)})
+		return
+	}
+
+	var messages []string
+	for _, header := range uploads {
+		if header.Size > MaxImageUpload {
+			messages = append(messages, header.Filename+": the image is larger than 10MB.")
+			continue
+		}
+		if err := h.addProductImage(r, productID, header); err != nil {
+			messages = append(messages, header.Filename+": "+apperr.Message(err))
+			if errors.Is(err, repository.ErrNotFound) {
+				break
+			}
+		}
+	}
+
+	h.renderProductImages(w, r, productID, messages)
+}
+
+func (h *Handler) addProductImage(r *http.Request, productID uuid.UUID, header *multipart.FileHeader) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	filename, err := saveProductImage(file)
+	if err != nil {
+		if !errors.Is(err, errNotAnImage) {
+			slog.ErrorContext(r.Context(), "saving product image", "err", err)
+		}
+		return err
+	}
+	if err := h.Repo.Product.AddProductImage(h.audited(r, AuditProductUpdate), productID, filename); err != nil {
+		removeProductImage(r, filename)
+		return err
+	}
+
+	if err := h.Jobs.Enqueue(background(r), jobs.JobProcessProductImage, jobs.ImagePayload{Filename: filename}); err != nil {
+		slog.ErrorContext(r.Context(), "queueing image processing", "err", err)
+	}
+	return nil
+}
+
+// RemoveProductImage takes an image out of the gallery of a product and
+// deletes it
+func (h *Handler) RemoveProductImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid product ID.")
+		return
+	}
+	image := vars["image"]
+
+	if err := h.Repo.Product.RemoveProductImage(h.audited(r, AuditProductUpdate), productID, image); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if err := h.Jobs.Enqueue(background(r), jobs.JobDeleteProductImage, jobs.ImagePayload{Filename: image}); err != nil {
+		slog.ErrorContext(r.Context(), "queueing image removal", "err", err)
+	}
+
+	h.renderProductImages(w, r, productID, nil)
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/catalog"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// importTTL is how long an uploaded catalog waits for the admin to confirm it
+const importTTL = 30 * time.Minute
+
+// pendingImport is a validated catalog upload waiting for confirmation, it
+// is kept in the database so any instance can confirm it
+type pendingImport struct {
+	Rows   []catalog.Row
+	Errors []catalog.RowError
+}
+
+func (h *Handler) storePendingImport(ctx context.Context, filename string, p *pendingImport) (uuid.UUID, error) {
+	if _, err := h.Repo.Imports.PurgeImports(ctx, importTTL); err != nil {
+		slog.WarnContext(ctx, "purging expired imports", "err", err)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	stored := &models.ProductImport{Filename: filename, Data: data}
+	if err := h.Repo.Imports.SaveImport(ctx, stored); err != nil {
+		return uuid.Nil, err
+	}
+	return stored.ImportID, nil
+}
+
+// getPendingImport returns a not found error once the import expired
+func (h *Handler) getPendingImport(ctx context.Context, token uuid.UUID) (*pendingImport, error) {
+	stored, err := h.Repo.Imports.GetImport(ctx, token)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && time.Since(stored.DateCreated) > importTTL) {
+		return nil, errImportExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p pendingImport
+	if err := json.Unmarshal(stored.Data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+var errImportExpired = apperr.NotFound("This import has expired, upload the file again.")
+
+// ImportPreviewRow describes what importing one row would do
+type ImportPreviewRow struct {
+	Line    int
+	Product models.Product
+	Action  string
+	Changes []string
+}
+
+func (h *Handler) ImportProductsView(w http.ResponseWriter, r *http.Request) {
+	render(w, r, "importProducts", nil)
+}
+
+// PreviewImport validates an uploaded catalog and shows what importing it would change
+func (h *Handler) PreviewImport(w http.ResponseWriter, r *http.Request) {
+	//Parse the multipart form, 10MB max upload size
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		sendProductMessage(w, r, []string{"The file could not be read, it must be smaller than 10MB"}, nil)
+		return
+	}
+
+	file, header, err := r.FormFile("catalog")
+	if err != nil {
+		sendProductMessage(w, r, []string{"Select a CSV or JSON file to import"}, nil)
+		return
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if format != "csv" && format != "json" {
+		sendProductMessage(w, r, []string{"Only .csv and .json files can be imported"}, nil)
+		return
+	}
+
+	rows, rowErrors, err := catalog.Parse(file, format)
+	if err != nil {
+		sendProductMessage(w, r, []string{"The file could not be read: " + err.Error()}, nil)
+		return
+	}
+
+	existing, err := h.Repo.Product.SearchProducts(r.Context(), repository.ProductFilter{Archived: repository.ArchivedInclude})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	bySKU := make(map[string]models.Product, len(existing))
+	byImage := make(map[string]models.Product, len(existing))
+	for _, product := range existing {
+		if product.SKU != "" {
+			bySKU[product.SKU] = product
+		}
+		byImage[product.ProductImage] = product
+	}
+
+	//An image may only stay with the product that already has it
+	valid := rows[:0]
+	for _, row := range rows {
+		image := row.Product.ProductImage
+		if owner, ok := byImage[image]; ok && image != "" && image != models.PlaceholderImage && (owner.SKU == "" || owner.SKU != row.Product.SKU) {
+			rowErrors = append(rowErrors, catalog.RowError{Line: row.Line, SKU: row.Product.SKU, Field: "product_image", Message: "is already used by another product"})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	rows = valid
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+
+	var preview []ImportPreviewRow
+	created, updated, unchanged := 0, 0, 0
+	for _, row := range rows {
+		item := ImportPreviewRow{Line: row.Line, Product: row.Product}
+		if current, ok := bySKU[row.Product.SKU]; ok {
+			item.Changes = catalog.Changes(current, row.Product)
+			if len(item.Changes) == 0 {
+				item.Action = "unchanged"
+				unchanged++
+			} else {
+				item.Action = "update"
+				updated++
+			}
+		} else {
+			item.Action = "create"
+			created++
+		}
+		preview = append(preview, item)
+	}
+
+	token, err := h.storePendingImport(r.Context(), header.Filename, &pendingImport{
+		Rows:   rows,
+		Errors: rowErrors,
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	data := struct {
+		Token     uuid.UUID
+		Filename  string
+		Rows      []ImportPreviewRow
+		Errors    []catalog.RowError
+		Created   int
+		Updated   int
+		Unchanged int
+	}{
+		Token:     token,
+		Filename:  header.Filename,
+		Rows:      preview,
+		Errors:    rowErrors,
+		Created:   created,
+		Updated:   updated,
+		Unchanged: unchanged,
+	}
+
+	render(w, r, "importPreview", data)
+}
+
+// ConfirmImport writes a previewed catalog to the database
+func (h *Handler) ConfirmImport(w http.ResponseWriter, r *http.Request) {
+	token, err := uuid.Parse(mux.Vars(r)["token"])
+	if err != nil {
+		badRequest(w, r, "Invalid import.")
+		return
+	}
+
+	pending, err := h.getPendingImport(r.Context(), token)
+	if errors.Is(err, errImportExpired) {
+		sendProductMessage(w, r, []string{"This import has expired, upload the file again"}, nil)
+		return
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if len(pending.Errors) > 0 {
+		sendProductMessage(w, r, []string{"Fix the errors in the file and upload it again"}, nil)
+		return
+	}
+
+	products := make([]models.Product, 0, len(pending.Rows))
+	for _, row := range pending.Rows {
+		products = append(products, row.Product)
+	}
+
+	created, updated, err := h.Repo.Product.ImportProducts(h.audited(r, AuditProductImport), products)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "importing products", "err", err)
+		sendProductMessage(w, r, []string{"The import failed and no products were changed. " + apperr.Message(err)}, nil)
+		return
+	}
+	if err := h.Repo.Imports.DeleteImport(r.Context(), token); err != nil {
+		slog.WarnContext(r.Context(), "deleting confirmed import", "err", err)
+	}
+
+	sendProductMessage(w, r, []string{fmt.Sprintf("Import complete: %d products created, %d updated", created, updated)}, nil)
+}
+
+// ImportErrors downloads the validation errors of an uploaded catalog as CSV
+func (h *Handler) ImportErrors(w http.ResponseWriter, r *http.Request) {
+	token, err := uuid.Parse(mux.Vars(r)["token"])
+	if err != nil {
+		badRequest(w, r, "Invalid import.")
+		return
+	}
+
+	pending, err := h.getPendingImport(r.Context(), token)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="import-errors.csv"`)
+	if err := catalog.WriteErrorsCSV(w, pending.Errors); err != nil {
+		slog.ErrorContext(r.Context(), "writing import errors", "err", err)
+	}
+}
+
+// ExportProducts downloads the full catalog, archived products included
+func (h *Handler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		badRequest(w, r, "Unsupported format.")
+		return
+	}
+
+	products, err := h.Repo.Product.SearchProducts(r.Context(), repository.ProductFilter{Archived: repository.ArchivedInclude})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("products-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		err = catalog.WriteJSON(w, products)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = catalog.WriteCSV(w, products)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exporting products", "err", err)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/catalog"
+	"github.com/snipep/Ecommerce-application/pkg/invoices"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// issueInvoice bills order at the current tax and shipping settings. An
+// order keeps the invoice it was issued first.
+func (h *Handler) issueInvoice(ctx context.Context, order *models.Order) (*models.Invoice, error) {
+	calculated := invoices.Calculate(order, h.Config.Store)
+	return h.Repo.Invoice.IssueInvoice(ctx, &calculated)
+}
+
+// OrderInvoice downloads the PDF invoice of an order. Invoices are issued
+// when the order is placed, or by IssueOrderInvoice for older orders.
+func (h *Handler) OrderInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid order ID.")
+		return
+	}
+
+	order, err := h.Repo.Order.GetOrderWithProducts(r.Context(), orderID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	invoice, err := h.Repo.Invoice.GetInvoiceByOrderID(r.Context(), orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = apperr.NotFound("The order has no invoice yet.")
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, invoice.Number()))
+	if err := invoices.WritePDF(w, invoice, order, h.Config.Store); err != nil {
+		slog.ErrorContext(r.Context(), "writing invoice", "err", err)
+	}
+}
+
+// IssueOrderInvoice issues the invoice of an order placed before invoices
+// were issued at checkout, and shows the order again
+func (h *Handler) IssueOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		badRequest(w, r, "Invalid order ID.")
+		return
+	}
+
+	order, err := h.Repo.Order.GetOrderWithProducts(r.Context(), orderID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if _, err := h.issueInvoice(r.Context(), order); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	h.renderOrder(w, r, order)
+}
+
+// exportBatchSize is how many orders ExportOrders reads per query
+const exportBatchSize = 500
+
+// ExportOrders downloads the orders matching the admin order filters as CSV
+func (h *Handler) ExportOrders(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	filter := parseOrderFilter(params)
+	filter.Limit = exportBatchSize
+
+	filename := "orders"
+	if from := params.Get("from"); from != "" {
+		filename += "-from-" + from
+	}
+	if to := params.Get("to"); to != "" {
+		filename += "-to-" + to
+	}
+
+	writer := csv.NewWriter(w)
+	headerWritten := false
+
+	for {
+		orders, err := h.Repo.Order.SearchOrders(r.Context(), filter)
+		if err != nil {
+			if !headerWritten {
+				respondError(w, r, err)
+				return
+			}
+			slog.ErrorContext(r.Context(), "exporting orders", "err", err)
+			return
+		}
+
+		if !headerWritten {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+			writer.Write([]string{"order_id", "customer", "status", "order_date", "total"})
+			headerWritten = true
+		}
+
+		for _, order := range orders {
+			writer.Write([]string{
+				order.OrderID.String(),
+				catalog.EscapeCell(order.Customer.Email),
+				order.OrderStatus,
+				order.OrderDate.Format(time.RFC3339),
+				strconv.FormatFloat(order.Total, 'f', 2, 64),
+			})
+		}
+
+		if len(orders) < filter.Limit {
+			break
+		}
+		filter.Offset += filter.Limit
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "exporting orders", "err", err)
+	}
+}
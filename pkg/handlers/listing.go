@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SortColumn is a sortable table header. Query is the query string that
+// sorts by this column, toggling the direction if it is already active.
+type SortColumn struct {
+	Label  string
+	Key    string
+	Query  string
+	Active bool
+	Desc   bool
+}
+
+// ListView is passed to the templates that render a filterable table. It
+// keeps the active filters so they survive paging, sorting and bookmarking.
+type ListView struct {
+	Params url.Values
+	// Query holds the active filters and sorting, without paging
+	Query   string
+	Columns []SortColumn
+}
+
+// pagingParams are dropped when building links that start a new listing
+var pagingParams = []string{"page", "limit"}
+
+func newListView(params url.Values, columns [][2]string) ListView {
+	filters := cleanParams(params, pagingParams...)
+
+	sortBy := params.Get("sort")
+	sortDesc := params.Get("dir") == "desc"
+
+	var sortColumns []SortColumn
+	for _, column := range columns {
+		active := sortBy == column[0]
+
+		direction := "asc"
+		if active && !sortDesc {
+			direction = "desc"
+		}
+		query := cleanParams(filters, "sort", "dir")
+		query.Set("sort", column[0])
+		query.Set("dir", direction)
+
+		sortColumns = append(sortColumns, SortColumn{
+			Label:  column[1],
+			Key:    column[0],
+			Query:  query.Encode(),
+			Active: active,
+			Desc:   active && sortDesc,
+		})
+	}
+
+	return ListView{
+		Params:  filters,
+		Query:   filters.Encode(),
+		Columns: sortColumns,
+	}
+}
+
+// cleanParams copies params without empty values and the given keys
+func cleanParams(params url.Values, drop ...string) url.Values {
+	cleaned := url.Values{}
+	for key, values := range params {
+		for _, value := range values {
+			if value != "" {
+				cleaned.Add(key, value)
+			}
+		}
+	}
+	for _, key := range drop {
+		cleaned.Del(key)
+	}
+	return cleaned
+}
+
+func parsePaging(params url.Values) (page, limit int) {
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err = strconv.Atoi(params.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 10 //default
+	}
+	return page, limit
+}
+
+// parseDate reads a yyyy-mm-dd date, returning the zero time if it is missing or invalid
+func parseDate(value string) time.Time {
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+func parseOptionalFloat(value string) *float64 {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &number
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// defaultReportDays is the range the dashboard opens with
+const defaultReportDays = 30
+
+// maxReportPoints keeps the revenue chart readable, longer ranges switch
+// to a coarser interval
+const maxReportPoints = 120
+
+// DashboardView is passed to the dashboard template
+type DashboardView struct {
+	Page
+	From     string
+	To       string
+	Interval string
+}
+
+// parseReportRange reads the from/to dates of a report, both inclusive,
+// defaulting to the last 30 days
+func parseReportRange(params url.Values) (repository.ReportRange, DashboardView) {
+	today := parseDate(time.Now().Format("2006-01-02"))
+
+	to := parseDate(params.Get("to"))
+	if to.IsZero() {
+		to = today
+	}
+	from := parseDate(params.Get("from"))
+	if from.IsZero() || from.After(to) {
+		from = to.AddDate(0, 0, -(defaultReportDays - 1))
+	}
+
+	rr := repository.ReportRange{From: from, To: to.AddDate(0, 0, 1)}
+	view := DashboardView{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Interval: reportInterval(params.Get("interval"), rr),
+	}
+	return rr, view
+}
+
+// reportInterval validates the requested interval, picking one from the
+// length of the range when none is given or it would be too fine
+func reportInterval(interval string, rr repository.ReportRange) string {
+	days := int(rr.To.Sub(rr.From).Hours() / 24)
+
+	switch interval {
+	case repository.IntervalDay, repository.IntervalWeek, repository.IntervalMonth:
+	default:
+		interval = repository.IntervalDay
+	}
+	if interval == repository.IntervalDay && days > maxReportPoints {
+		interval = repository.IntervalWeek
+	}
+	if interval == repository.IntervalWeek && days/7 > maxReportPoints {
+		interval = repository.IntervalMonth
+	}
+	return interval
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("writing json", "err", err)
+	}
+}
+
+func (h *Handler) DashboardPage(w http.ResponseWriter, r *http.Request) {
+	_, view := parseReportRange(r.URL.Query())
+	view.Page = newPage(r)
+	render(w, r, "dashboard", view)
+}
+
+func (h *Handler) ReportSummary(w http.ResponseWriter, r *http.Request) {
+	rr, _ := parseReportRange(r.URL.Query())
+	summary, err := h.Repo.Report.Summary(r.Context(), rr)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	writeJSON(w, summary)
+}
+
+func (h *Handler) ReportRevenue(w http.ResponseWriter, r *http.Request) {
+	rr, view := parseReportRange(r.URL.Query())
+	points, err := h.Repo.Report.RevenueOverTime(r.Context(), rr, view.Interval)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	data := struct {
+		Interval string                `json:"interval"`
+		Points   []models.RevenuePoint `json:"points"`
+	}{
+		Interval: view.Interval,
+		Points:   points,
+	}
+	writeJSON(w, data)
+}
+
+func (h *Handler) ReportTopProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	rr, _ := parseReportRange(params)
+
+	limit, err := strconv.Atoi(params.Get("limit"))
+	if err != nil || limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	products, err := h.Repo.Report.TopProducts(r.Context(), rr, limit)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	writeJSON(w, products)
+}
+
+func (h *Handler) ReportOrderStatuses(w http.ResponseWriter, r *http.Request) {
+	rr, _ := parseReportRange(r.URL.Query())
+	statuses, err := h.Repo.Report.OrdersByStatus(r.Context(), rr)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	writeJSON(w, statuses)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// maxDescription is about as much of a meta description as search results show
+const maxDescription = 160
+
+// maxSitemapURLs is the most URLs a single sitemap may list
+const maxSitemapURLs = 50000
+
+// absoluteURL is path on the public address of the store, for canonical
+// links, sitemaps and structured data
+func (h *Handler) absoluteURL(path string) string {
+	return strings.TrimSuffix(h.Config.BaseURL, "/") + path
+}
+
+// productPath is the storefront address of a product
+func productPath(p *models.Product) string {
+	return "/p/" + url.PathEscape(p.Slug)
+}
+
+// seoPage is newPage for storefront pages that search engines should index
+// at path. An empty title stands for the store itself.
+func (h *Handler) seoPage(r *http.Request, title, description, path string) Page {
+	page := newPage(r)
+	page.Title = h.Config.Store.Name
+	if title != "" {
+		page.Title = title + " | " + h.Config.Store.Name
+	}
+	page.Description = metaDescription(description)
+	page.CanonicalURL = h.absoluteURL(path)
+	return page
+}
+
+// metaDescription fits text on one line of a search result, cutting it at a
+// word where it is too long
+func metaDescription(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxDescription {
+		return text
+	}
+
+	cut := string([]rune(text)[:maxDescription-1])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// productStructuredData describes a product and its offer with schema.org
+// types, as JSON-LD
+func (h *Handler) productStructuredData(p *models.Product) map[string]any {
+	productURL := h.absoluteURL(productPath(p))
+
+	images := []string{h.absoluteURL("/static/uploads/" + url.PathEscape(p.ProductImage))}
+	for _, image := range p.Images {
+		images = append(images, h.absoluteURL("/static/uploads/"+url.PathEscape(image)))
+	}
+
+	data := map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       "Product",
+		"name":        p.ProductName,
+		"description": p.Description,
+		"image":       images,
+		"url":         productURL,
+		"offers": map[string]any{
+			"@type":         "Offer",
+			"url":           productURL,
+			"price":         fmt.Sprintf("%.2f", p.Price),
+			"priceCurrency": h.Config.Store.Currency,
+			"availability":  "https://schema.org/InStock",
+			"itemCondition": "https://schema.org/NewCondition",
+		},
+	}
+	if p.SKU != "" {
+		data["sku"] = p.SKU
+	}
+	if p.Category != "" {
+		data["category"] = p.Category
+	}
+	return data
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// Sitemap lists the storefront and every product shown on it
+func (h *Handler) Sitemap(w http.ResponseWriter, r *http.Request) {
+	products, err := h.Repo.Product.SearchProducts(r.Context(), repository.ProductFilter{
+		WithImage: true,
+		SortBy:    "name",
+		Limit:     maxSitemapURLs - 1,
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	urls := sitemap{
+		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		URLs:  []sitemapURL{{Loc: h.absoluteURL("/")}},
+	}
+	for i := range products {
+		urls.URLs = append(urls.URLs, sitemapURL{
+			Loc:     h.absoluteURL(productPath(&products[i])),
+			LastMod: products[i].DateModified.UTC().Format("2006-01-02"),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(urls); err != nil {
+		slog.ErrorContext(r.Context(), "writing sitemap", "err", err)
+	}
+}
+
+// crawlerDisallowed are the admin pages and the fragments and actions of
+// the storefront, none of which belong in search results
+var crawlerDisallowed = []string{
+	"/dashboard",
+	"/manageproducts",
+	"/manageorders",
+	"/audit",
+	"/allproducts",
+	"/allorders",
+	"/products",
+	"/orders",
+	"/reports",
+	"/createproduct",
+	"/editproduct",
+	"/importproducts",
+	"/seed-products",
+	"/shoppingitems",
+	"/cartitems",
+	"/gotocart",
+	"/addtocart",
+	"/updateorderitem",
+	"/ordercomplete",
+}
+
+// Robots points crawlers at the sitemap and away from everything else
+func (h *Handler) Robots(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for _, path := range crawlerDisallowed {
+		b.WriteString("Disallow: " + path + "\n")
+	}
+	b.WriteString("\nSitemap: " + h.absoluteURL("/sitemap.xml") + "\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(b.String()))
+}
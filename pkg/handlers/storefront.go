@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// storefrontPageSize is how many products each page of the storefront shows,
+// a multiple of the three columns of the grid
+const storefrontPageSize = 12
+
+// StorefrontSort is a way to order the storefront, Key is what the sort
+// query parameter holds
+type StorefrontSort struct {
+	Key    string
+	Label  string
+	SortBy string
+	Desc   bool
+}
+
+// storefrontSorts lists the storefront orders, the first is the default
+var storefrontSorts = []StorefrontSort{
+	{Key: "newest", Label: "Newest", SortBy: "created", Desc: true},
+	{Key: "price_asc", Label: "Price: low to high", SortBy: "price"},
+	{Key: "price_desc", Label: "Price: high to low", SortBy: "price", Desc: true},
+	{Key: "name", Label: "Name", SortBy: "name"},
+}
+
+// StorefrontView is a page of the storefront. The pages are keyset paged:
+// NextQuery and PrevQuery hold the sort and the product the adjacent page
+// starts after or ends before, so they stay put while products are added.
+type StorefrontView struct {
+	Products  []models.Product
+	Sort      string
+	Sorts     []StorefrontSort
+	HasNext   bool
+	HasPrev   bool
+	NextQuery template.URL
+	PrevQuery template.URL
+	// Paged is set past the first page
+	Paged bool
+}
+
+// storefront loads the page of products the query of r asks for, ignoring
+// unknown sorts and malformed cursors
+func (h *Handler) storefront(r *http.Request) (StorefrontView, error) {
+	params := r.URL.Query()
+
+	sort := storefrontSorts[0]
+	if i := slices.IndexFunc(storefrontSorts, func(s StorefrontSort) bool { return s.Key == params.Get("sort") }); i >= 0 {
+		sort = storefrontSorts[i]
+	}
+
+	filter := repository.ProductFilter{
+		WithImage: true,
+		SortBy:    sort.SortBy,
+		SortDesc:  sort.Desc,
+		//One more than a page tells whether there is another one
+		Limit: storefrontPageSize + 1,
+	}
+	if id, err := uuid.Parse(params.Get("after")); err == nil {
+		filter.After = id
+	} else if id, err := uuid.Parse(params.Get("before")); err == nil {
+		filter.Before = id
+	}
+
+	products, err := h.Repo.Product.SearchProducts(r.Context(), filter)
+	if err != nil {
+		return StorefrontView{}, err
+	}
+
+	view := StorefrontView{
+		Sort:  sort.Key,
+		Sorts: storefrontSorts,
+		Paged: filter.After != uuid.Nil || filter.Before != uuid.Nil,
+	}
+	if filter.Before != uuid.Nil {
+		//The extra product of a page before the cursor comes first
+		view.HasPrev = len(products) > storefrontPageSize
+		view.HasNext = true
+		products = products[max(len(products)-storefrontPageSize, 0):]
+	} else {
+		view.HasNext = len(products) > storefrontPageSize
+		view.HasPrev = filter.After != uuid.Nil
+		products = products[:min(len(products), storefrontPageSize)]
+	}
+	view.Products = products
+
+	if len(products) > 0 {
+		view.NextQuery = storefrontQuery(sort, "after", products[len(products)-1].ProductID)
+		view.PrevQuery = storefrontQuery(sort, "before", products[0].ProductID)
+	} else {
+		//A cursor past either end, start over
+		view.HasNext = false
+		view.HasPrev = false
+	}
+	return view, nil
+}
+
+// storefrontQuery is the query string of the page at cursor, leaving out the
+// default sort. It is encoded already, so links use it as it is.
+func storefrontQuery(sort StorefrontSort, key string, cursor uuid.UUID) template.URL {
+	query := url.Values{}
+	if sort.Key != storefrontSorts[0].Key {
+		query.Set("sort", sort.Key)
+	}
+	query.Set(key, cursor.String())
+	return template.URL(query.Encode())
+}
@@ -0,0 +1,157 @@
+// Package invoices computes invoice amounts for orders and renders them as PDF.
+package invoices
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Calculate works out the amounts to bill for order with the store's
+// current tax and shipping settings.
+func Calculate(order *models.Order, store config.StoreConfig) models.Invoice {
+	subtotal := 0.0
+	for _, item := range order.Items {
+		subtotal += item.Cost
+	}
+	subtotal = round(subtotal)
+
+	shipping := store.ShippingFee
+	if store.FreeShippingOver > 0 && subtotal >= store.FreeShippingOver {
+		shipping = 0
+	}
+
+	tax := round(subtotal * store.TaxRate)
+
+	return models.Invoice{
+		OrderID:  order.OrderID,
+		Subtotal: subtotal,
+		TaxRate:  store.TaxRate,
+		Tax:      tax,
+		Shipping: round(shipping),
+		Total:    round(subtotal + tax + shipping),
+	}
+}
+
+// WritePDF renders invoice as a single A4 PDF document.
+func WritePDF(w io.Writer, invoice *models.Invoice, order *models.Order, store config.StoreConfig) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(invoice.Number(), true)
+	pdf.SetAuthor(store.Name, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+
+	// The core fonts only cover cp1252, translate UTF-8 text into it
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	// Store details
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(100, 8, tr(store.Name), "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(70, 8, "INVOICE", "", 1, "R", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	y := pdf.GetY() + 2
+	pdf.SetY(y)
+	for _, line := range []string{store.Address, store.Email, store.Phone} {
+		if line != "" {
+			pdf.MultiCell(100, 5, tr(line), "", "L", false)
+		}
+	}
+	if store.TaxID != "" {
+		pdf.MultiCell(100, 5, tr("Tax ID: "+store.TaxID), "", "L", false)
+	}
+	storeBottom := pdf.GetY()
+
+	// Invoice details
+	pdf.SetXY(120, y)
+	details := [][2]string{
+		{"Invoice number", invoice.Number()},
+		{"Invoice date", invoice.IssuedAt.Format("02 Jan 2006")},
+		{"Order date", order.OrderDate.Format("02 Jan 2006")},
+	}
+	for _, detail := range details {
+		pdf.SetX(120)
+		pdf.CellFormat(30, 5, detail[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 5, detail[1], "", 1, "R", false, 0, "")
+	}
+
+	// Bill to
+	pdf.SetY(math.Max(storeBottom, pdf.GetY()) + 10)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(0, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	// Orders placed before checkout asked for billing details only have the email
+	for _, line := range []string{order.Customer.Name, order.Customer.Address, order.Customer.Email} {
+		if line != "" {
+			pdf.MultiCell(100, 5, tr(line), "", "L", false)
+		}
+	}
+	pdf.CellFormat(0, 5, "Order "+order.OrderID.String(), "", 1, "L", false, 0, "")
+	pdf.Ln(8)
+
+	// Line items
+	widths := []float64{90, 20, 30, 30}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(233, 236, 239)
+	for i, heading := range []string{"Item", "Quantity", "Unit price", "Amount"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, heading, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, item := range order.Items {
+		unitPrice := 0.0
+		if item.Quantity > 0 {
+			unitPrice = item.Cost / float64(item.Quantity)
+		}
+		pdf.CellFormat(widths[0], 7, tr(item.Product.ProductName), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 7, fmt.Sprint(item.Quantity), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 7, money(unitPrice), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 7, money(item.Cost), "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// Totals
+	totals := [][2]string{
+		{"Subtotal", money(invoice.Subtotal)},
+		{fmt.Sprintf("Tax (%s%%)", formatRate(invoice.TaxRate)), money(invoice.Tax)},
+		{"Shipping", money(invoice.Shipping)},
+	}
+	for _, total := range totals {
+		pdf.CellFormat(widths[0]+widths[1], 6, "", "", 0, "", false, 0, "")
+		pdf.CellFormat(widths[2], 6, total[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 6, total[1], "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(widths[0]+widths[1], 8, "", "", 0, "", false, 0, "")
+	pdf.CellFormat(widths[2], 8, "Total", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 8, money(invoice.Total), "T", 1, "R", false, 0, "")
+
+	pdf.Ln(12)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(108, 117, 125)
+	pdf.MultiCell(0, 5, tr("Thank you for shopping with "+store.Name+"."), "", "L", false)
+
+	return pdf.Output(w)
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%g", round(rate*100))
+}
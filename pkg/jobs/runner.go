@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// HandlerFunc runs a single job. The payload is the JSON document the job
+// was enqueued with. Returning an error schedules a retry.
+type HandlerFunc func(ctx context.Context, payload []byte) error
+
+// Queue accepts work for the background. Runner implements it, handlers
+// depend on the interface so they can run without the jobs table.
+type Queue interface {
+	Enqueue(ctx context.Context, jobType string, payload any) error
+}
+
+// Runner executes jobs from the jobs table with a pool of workers. Failed
+// jobs are retried with exponential backoff and moved to the dead-letter
+// status once they run out of attempts.
+type Runner struct {
+	Jobs         repository.JobStore
+	Workers      int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// Timeout bounds a single attempt of a job. It must be shorter than
+	// StaleAfter, or a slow job is requeued while it still runs.
+	Timeout time.Duration
+	// StaleAfter is how long a job may stay running before it is requeued,
+	// the instance running it is assumed to have died
+	StaleAfter time.Duration
+	// ShutdownGrace is how long the jobs in flight get to finish once Run's
+	// ctx is cancelled
+	ShutdownGrace time.Duration
+
+	mu        sync.RWMutex
+	handlers  map[string]HandlerFunc
+	recurring []recurringJob
+}
+
+type recurringJob struct {
+	jobType  string
+	interval time.Duration
+}
+
+func NewRunner(jobs repository.JobStore) *Runner {
+	return &Runner{
+		Jobs:          jobs,
+		Workers:       4,
+		PollInterval:  time.Second,
+		MaxAttempts:   5,
+		BaseBackoff:   10 * time.Second,
+		MaxBackoff:    30 * time.Minute,
+		Timeout:       5 * time.Minute,
+		StaleAfter:    10 * time.Minute,
+		ShutdownGrace: 25 * time.Second,
+		handlers:      make(map[string]HandlerFunc),
+	}
+}
+
+func (r *Runner) Register(jobType string, handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+}
+
+// Every runs jobType on a fixed interval for as long as the runner is running.
+func (r *Runner) Every(interval time.Duration, jobType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recurring = append(r.recurring, recurringJob{jobType: jobType, interval: interval})
+}
+
+// Enqueue queues a job to run as soon as a worker is free.
+func (r *Runner) Enqueue(ctx context.Context, jobType string, payload any) error {
+	return r.EnqueueAt(ctx, time.Now(), jobType, payload)
+}
+
+// EnqueueAt queues a job that will not run before runAt.
+func (r *Runner) EnqueueAt(ctx context.Context, runAt time.Time, jobType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return r.Jobs.Enqueue(ctx, &models.Job{
+		JobType:     jobType,
+		Payload:     string(data),
+		MaxAttempts: r.MaxAttempts,
+		RunAt:       runAt,
+	})
+}
+
+// Run polls for due jobs and blocks until ctx is cancelled. Jobs already
+// handed to a worker get ShutdownGrace to finish, those still running then
+// are cancelled and go back to pending without counting an attempt.
+func (r *Runner) Run(ctx context.Context) {
+	r.requeueStale(ctx)
+	go r.watchStale(ctx)
+
+	//Jobs outlive ctx by the grace period
+	jobsCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	queue := make(chan models.Job)
+	var wg sync.WaitGroup
+	for i := 0; i < r.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				r.execute(jobsCtx, job)
+			}
+		}()
+	}
+
+	r.mu.RLock()
+	for _, job := range r.recurring {
+		go r.schedule(ctx, job)
+	}
+	r.mu.RUnlock()
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		jobs, err := r.Jobs.ClaimDue(ctx, r.Workers)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "claiming jobs", "err", err)
+		}
+		for _, job := range jobs {
+			queue <- job
+		}
+
+		select {
+		case <-ctx.Done():
+			close(queue)
+			grace := time.AfterFunc(r.ShutdownGrace, cancelJobs)
+			wg.Wait()
+			grace.Stop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchStale keeps requeueing the jobs of instances that died while running
+// them, other instances may crash at any time
+func (r *Runner) watchStale(ctx context.Context) {
+	ticker := time.NewTicker(r.StaleAfter / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.requeueStale(ctx)
+		}
+	}
+}
+
+func (r *Runner) requeueStale(ctx context.Context) {
+	if n, err := r.Jobs.RequeueStale(ctx, r.StaleAfter); err != nil {
+		slog.ErrorContext(ctx, "requeueing stale jobs", "err", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "requeued stale jobs", "count", n)
+	}
+}
+
+func (r *Runner) schedule(ctx context.Context, job recurringJob) {
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Enqueue(ctx, job.jobType, nil); err != nil {
+				slog.ErrorContext(ctx, "scheduling job", "job_type", job.jobType, "err", err)
+			}
+		}
+	}
+}
+
+func (r *Runner) execute(ctx context.Context, job models.Job) {
+	r.mu.RLock()
+	handler, ok := r.handlers[job.JobType]
+	r.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler registered for job type %q", job.JobType)
+	} else {
+		jobCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+		err = runSafely(jobCtx, handler, []byte(job.Payload))
+		cancel()
+	}
+
+	//Record the outcome even if the grace period ran out meanwhile
+	interrupted := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+
+	if err != nil && interrupted {
+		slog.InfoContext(ctx, "job interrupted by shutdown, released", "job_id", job.JobID, "job_type", job.JobType, "err", err)
+		if err := r.Jobs.Release(ctx, job.JobID); err != nil {
+			slog.ErrorContext(ctx, "releasing job", "job_id", job.JobID, "err", err)
+		}
+		return
+	}
+
+	if err == nil {
+		if err := r.Jobs.Complete(ctx, job.JobID); err != nil {
+			slog.ErrorContext(ctx, "completing job", "job_id", job.JobID, "err", err)
+		}
+		return
+	}
+
+	attempts := job.Attempts + 1
+	status := models.JobStatusPending
+	if attempts >= job.MaxAttempts {
+		status = models.JobStatusDead
+	}
+
+	slog.WarnContext(ctx, "job failed", "job_id", job.JobID, "job_type", job.JobType, "attempt", attempts, "dead", status == models.JobStatusDead, "err", err)
+	if err := r.Jobs.Fail(ctx, job.JobID, status, err.Error(), time.Now().Add(r.backoff(attempts))); err != nil {
+		slog.ErrorContext(ctx, "recording job failure", "job_id", job.JobID, "err", err)
+	}
+}
+
+// runSafely turns a panicking handler into a failed attempt instead of
+// taking the worker down with it.
+func runSafely(ctx context.Context, handler HandlerFunc, payload []byte) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+func (r *Runner) backoff(attempts int) time.Duration {
+	backoff := r.BaseBackoff
+	for i := 1; i < attempts && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, r.MaxBackoff)
+}
@@ -0,0 +1,229 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+func openTestDB(t *testing.T) *repository.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := repository.Open(context.Background(), "sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := repository.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestRunner returns a runner on a fresh SQLite jobs table with a single
+// job of type "test", which handler runs
+func newTestRunner(t *testing.T, maxAttempts int, handler HandlerFunc) (*Runner, *repository.DB, uuid.UUID) {
+	t.Helper()
+	db := openTestDB(t)
+	r := NewRunner(repository.NewJobRepository(db))
+	r.Workers = 1
+	r.PollInterval = 10 * time.Millisecond
+	r.BaseBackoff = time.Minute
+	r.MaxBackoff = 4 * time.Minute
+	r.Register("test", handler)
+
+	job := &models.Job{JobType: "test", Payload: "{}", MaxAttempts: maxAttempts}
+	if err := r.Jobs.Enqueue(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	return r, db, job.JobID
+}
+
+type jobState struct {
+	status    string
+	attempts  int
+	lastError string
+	runAt     time.Time
+}
+
+func readJob(t *testing.T, db *repository.DB, jobID uuid.UUID) jobState {
+	t.Helper()
+	var state jobState
+	var lastError sql.NullString
+	query := "SELECT status, attempts, last_error, run_at FROM jobs WHERE job_id = ?"
+	if err := db.QueryRowContext(context.Background(), query, jobID).Scan(&state.status, &state.attempts, &lastError, &state.runAt); err != nil {
+		t.Fatal(err)
+	}
+	state.lastError = lastError.String
+	return state
+}
+
+// runDue makes the job due again and runs it once, the way a worker would
+func runDue(t *testing.T, r *Runner, db *repository.DB, jobID uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "UPDATE jobs SET run_at = ? WHERE job_id = ?", time.Now(), jobID); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := r.Jobs.ClaimDue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("claimed %d jobs, want 1", len(claimed))
+	}
+	r.execute(ctx, claimed[0])
+}
+
+func TestBackoff(t *testing.T) {
+	r := NewRunner(nil)
+	r.BaseBackoff = time.Second
+	r.MaxBackoff = 10 * time.Second
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := r.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRunnerRetriesUntilDead(t *testing.T) {
+	r, db, jobID := newTestRunner(t, 3, func(ctx context.Context, payload []byte) error {
+		return errors.New("smtp unavailable")
+	})
+
+	//Each failure doubles the wait, the third one is the last
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		before := time.Now()
+		runDue(t, r, db, jobID)
+
+		job := readJob(t, db, jobID)
+		if job.status != models.JobStatusPending || job.attempts != attempt+1 || job.lastError != "smtp unavailable" {
+			t.Fatalf("after attempt %d: %+v", attempt+1, job)
+		}
+		if job.runAt.Before(before.Add(backoff)) || job.runAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d retries at %v, want %v from now", attempt+1, job.runAt, backoff)
+		}
+	}
+
+	runDue(t, r, db, jobID)
+	if job := readJob(t, db, jobID); job.status != models.JobStatusDead || job.attempts != 3 {
+		t.Fatalf("after the last attempt: %+v", job)
+	}
+	if claimed, err := r.Jobs.ClaimDue(context.Background(), 10); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d dead jobs, err %v", len(claimed), err)
+	}
+}
+
+func TestRunnerRecoversPanics(t *testing.T) {
+	r, db, jobID := newTestRunner(t, 3, func(ctx context.Context, payload []byte) error {
+		panic("boom")
+	})
+
+	runDue(t, r, db, jobID)
+	if job := readJob(t, db, jobID); job.status != models.JobStatusPending || job.attempts != 1 || job.lastError != "panic: boom" {
+		t.Fatalf("after a panic: %+v", job)
+	}
+}
+
+func TestRunnerRequeuesStaleJobs(t *testing.T) {
+	r, db, jobID := newTestRunner(t, 2, func(ctx context.Context, payload []byte) error { return nil })
+	r.StaleAfter = time.Millisecond
+
+	//Another instance claims the job twice and dies both times
+	for attempt := 1; attempt <= 2; attempt++ {
+		if claimed, err := r.Jobs.ClaimDue(context.Background(), 10); err != nil || len(claimed) != 1 {
+			t.Fatalf("claimed %d jobs, err %v", len(claimed), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		r.requeueStale(context.Background())
+
+		want := models.JobStatusPending
+		if attempt == 2 {
+			want = models.JobStatusDead
+		}
+		if job := readJob(t, db, jobID); job.status != want || job.attempts != attempt {
+			t.Fatalf("after %d stale runs: %+v", attempt, job)
+		}
+	}
+}
+
+func TestRunnerShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		//grace is the runner's ShutdownGrace, finish whether the handler
+		//returns by itself once the runner is stopped
+		grace        time.Duration
+		finish       bool
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "finishes within grace", grace: time.Minute, finish: true, wantStatus: models.JobStatusDone, wantAttempts: 1},
+		{name: "released after grace", grace: 10 * time.Millisecond, finish: false, wantStatus: models.JobStatusPending, wantAttempts: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			finish := make(chan struct{})
+			interrupted := make(chan struct{}, 1)
+			r, db, jobID := newTestRunner(t, 3, func(ctx context.Context, payload []byte) error {
+				close(started)
+				select {
+				case <-finish:
+					return nil
+				case <-ctx.Done():
+					interrupted <- struct{}{}
+					return ctx.Err()
+				}
+			})
+			r.ShutdownGrace = tt.grace
+
+			ctx, stop := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				r.Run(ctx)
+				close(done)
+			}()
+
+			<-started
+			stop()
+			if tt.finish {
+				select {
+				case <-interrupted:
+					t.Fatal("stopping the runner cancelled the job")
+				case <-time.After(50 * time.Millisecond):
+				}
+				close(finish)
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return")
+			}
+
+			if job := readJob(t, db, jobID); job.status != tt.wantStatus || job.attempts != tt.wantAttempts {
+				t.Errorf("after shutdown: %+v", job)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "image/gif"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/notifications"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"golang.org/x/image/draw"
+)
+
+// Stock reconciliation and report generation have no jobs. The shop keeps
+// no stock to reconcile, and the dashboard runs its report queries when it
+// loads, as they are bounded by the selected date range.
+const (
+	JobSendOrderConfirmation = "email.order_confirmation"
+	JobSendOrderStatus       = "email.order_status"
+	JobFlushOutbox           = "email.flush_outbox"
+	JobProcessProductImage   = "product_image.process"
+	JobDeleteProductImage    = "product_image.delete"
+	JobPurgeJobs             = "jobs.purge"
+)
+
+// MaxImageWidth is the width uploaded product images are scaled down to.
+const MaxImageWidth = 1200
+
+// finishedJobRetention is how long completed jobs are kept around.
+const finishedJobRetention = 7 * 24 * time.Hour
+
+type OrderPayload struct {
+	OrderID uuid.UUID `json:"order_id"`
+}
+
+type ImagePayload struct {
+	Filename string `json:"filename"`
+}
+
+// Tasks holds the dependencies of the application's job handlers.
+type Tasks struct {
+	Repo       *repository.Repoitory
+	Notifier   *notifications.Notifier
+	Dispatcher *notifications.Dispatcher
+	UploadDir  string
+}
+
+func (t *Tasks) Register(runner *Runner) {
+	runner.Register(JobSendOrderConfirmation, t.sendOrderConfirmation)
+	runner.Register(JobSendOrderStatus, t.sendOrderStatus)
+	runner.Register(JobFlushOutbox, t.flushOutbox)
+	runner.Register(JobProcessProductImage, t.processProductImage)
+	runner.Register(JobDeleteProductImage, t.deleteProductImage)
+	runner.Register(JobPurgeJobs, t.purgeJobs)
+}
+
+func (t *Tasks) sendOrderConfirmation(ctx context.Context, payload []byte) error {
+	var p OrderPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	order, err := t.Repo.Order.GetOrderWithProducts(ctx, p.OrderID)
+	if err != nil {
+		return err
+	}
+	return t.Notifier.OrderConfirmation(ctx, order)
+}
+
+func (t *Tasks) sendOrderStatus(ctx context.Context, payload []byte) error {
+	var p OrderPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	order, err := t.Repo.Order.GetOrderWithProducts(ctx, p.OrderID)
+	if err != nil {
+		return err
+	}
+	return t.Notifier.OrderStatusChanged(ctx, order)
+}
+
+func (t *Tasks) flushOutbox(ctx context.Context, payload []byte) error {
+	return t.Dispatcher.Flush(ctx)
+}
+
+// processProductImage scales an uploaded image down to MaxImageWidth so the
+// storefront doesn't serve camera-sized originals. GIFs are left alone to
+// keep animations intact.
+func (t *Tasks) processProductImage(ctx context.Context, payload []byte) error {
+	var p ImagePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	path := filepath.Join(t.UploadDir, filepath.Base(p.Filename))
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	src, format, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	bounds := src.Bounds()
+	if bounds.Dx() <= MaxImageWidth || (format != "jpeg" && format != "png") {
+		return nil
+	}
+
+	height := bounds.Dy() * MaxImageWidth / bounds.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, MaxImageWidth, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	// Write next to the original and swap it in, so a crash never leaves a truncated image
+	tmp, err := os.CreateTemp(t.UploadDir, ".resize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == "png" {
+		err = png.Encode(tmp, dst)
+	} else {
+		err = jpeg.Encode(tmp, dst, &jpeg.Options{Quality: 85})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (t *Tasks) deleteProductImage(ctx context.Context, payload []byte) error {
+	var p ImagePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	filename := filepath.Base(p.Filename)
+	if filename == models.PlaceholderImage || filename == "." || filename == string(filepath.Separator) {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(t.UploadDir, filename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (t *Tasks) purgeJobs(ctx context.Context, payload []byte) error {
+	_, err := t.Repo.Jobs.PurgeDone(ctx, finishedJobRetention)
+	return err
+}
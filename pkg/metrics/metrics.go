@@ -0,0 +1,127 @@
+// Package metrics defines the Prometheus metrics of the store and the
+// middleware recording HTTP traffic. Everything is registered with the
+// default registry, which also carries the Go runtime and process metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shop"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by repository operation and outcome.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"op", "outcome"})
+
+	// OrdersPlaced counts orders placed through checkout
+	OrdersPlaced = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_placed_total",
+		Help:      "Orders placed through checkout.",
+	})
+
+	// CartAdds counts products added to a cart
+	CartAdds = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cart_adds_total",
+		Help:      "Products added to a cart.",
+	})
+
+	// CheckoutFailures counts checkouts that didn't result in an order
+	CheckoutFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checkout_failures_total",
+		Help:      "Checkouts that didn't result in an order, by reason.",
+	}, []string{"reason"})
+
+	// RateLimited counts requests rejected by the rate limiter
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the rate limiter, by rule and scope.",
+	}, []string{"rule", "scope"})
+)
+
+// Checkout failure reasons
+const (
+	ReasonEmptyCart = "empty_cart"
+	ReasonInvalid   = "invalid_details"
+	ReasonError     = "error"
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveQuery records how long a query of the repository operation op took
+func ObserveQuery(op string, duration time.Duration, err error) {
+	if op == "" {
+		op = "unknown"
+	}
+	dbQueryDuration.WithLabelValues(op, outcome(err)).Observe(duration.Seconds())
+}
+
+func outcome(err error) string {
+	switch {
+	case err == nil, errors.Is(err, sql.ErrNoRows):
+		return "ok"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+// Middleware records the requests served by a mux router. Requests are
+// labelled with the route template rather than the path, so IDs in URLs
+// don't create a series each.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		labels := prometheus.Labels{"route": route}
+		handler := promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels),
+			promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), next))
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited entities
+const (
+	AuditProduct = "product"
+	AuditOrder   = "order"
+)
+
+// AuditEntry records a change made from the admin pages
+type AuditEntry struct {
+	AuditID uuid.UUID
+	// Actor is the user the authenticating proxy vouched for, or anonymous@
+	// followed by the client IP
+	Actor     string
+	RemoteIP  string
+	RequestID string
+	// Action is the entity and what happened to it, e.g. "product.update"
+	Action      string
+	EntityType  string
+	EntityID    string
+	Changes     Changes
+	DateCreated time.Time
+}
+
+// Changes maps each changed field to its value before and after. Fields of
+// created entities have no before, those of deleted ones no after.
+type Changes map[string]Change
+
+type Change struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// Diff returns the fields whose values differ between before and after,
+// either may be nil
+func Diff(before, after map[string]any) Changes {
+	changes := Changes{}
+	for field, value := range before {
+		if other, ok := after[field]; !ok || other != value {
+			changes[field] = Change{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = Change{After: value}
+		}
+	}
+	return changes
+}
+
+// ProductFields are the audited fields of a product, nil for no product
+func ProductFields(p *Product) map[string]any {
+	if p == nil {
+		return nil
+	}
+	return map[string]any{
+		"sku":         p.SKU,
+		"name":        p.ProductName,
+		"price":       p.Price,
+		"description": p.Description,
+		"image":       p.ProductImage,
+		"images":      strings.Join(p.Images, ", "),
+		"category":    p.Category,
+		"archived":    p.Archived,
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invoice freezes the amounts billed for an order when it is first issued,
+// so later changes to tax or shipping settings don't alter it.
+type Invoice struct {
+	InvoiceNumber int
+	OrderID       uuid.UUID
+	Subtotal      float64
+	TaxRate       float64
+	Tax           float64
+	Shipping      float64
+	Total         float64
+	IssuedAt      time.Time
+}
+
+func (i Invoice) Number() string {
+	return fmt.Sprintf("INV-%06d", i.InvoiceNumber)
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusDead    = "dead"
+)
+
+type Job struct {
+	JobID        uuid.UUID
+	JobType      string
+	Payload      string
+	Status       string
+	Attempts     int
+	MaxAttempts  int
+	LastError    string
+	RunAt        time.Time
+	DateCreated  time.Time
+	DateModified time.Time
+}
@@ -6,10 +6,21 @@ import (
 	"github.com/google/uuid"
 )
 
+// Customer is who placed an order, as entered at checkout
+type Customer struct {
+	Email   string
+	Name    string
+	// Address is the billing address, one line per line of the address
+	Address string
+}
+
 type Order struct {
 	OrderID     uuid.UUID
+	// UserID is the account the order was placed with, empty for guest checkouts
 	UserID      string
+	Customer    Customer
 	OrderStatus string
 	OrderDate   time.Time
+	Total       float64
 	Items       []OrderItem
 }
@@ -6,12 +6,26 @@ import (
 	"github.com/google/uuid"
 )
 
+// PlaceholderImage is shared by every product without an image of its own,
+// it is the only image products may share and is never removed
+const PlaceholderImage = "placeholder.jpg"
+
 type Product struct {
 	ProductID 		uuid.UUID
+	SKU 			string
 	ProductName 	string
 	Price 			float64
 	Description 	string
 	ProductImage 	string
+	// Images are shown after ProductImage in the product's gallery, in order
+	Images 			[]string
+	Category 		string
+	Archived 		bool
 	DateCreated 	time.Time
 	DateModified 	time.Time
+	// Version counts the changes to the product, an update based on an
+	// older version is rejected instead of overwriting the newer one
+	Version 		int
+	// Slug names the product in its storefront URL, /p/{slug}
+	Slug 			string
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProductImport is an uploaded catalog waiting for the admin to confirm it.
+// Data holds the validated rows, encoded by the handler that previews them.
+type ProductImport struct {
+	ImportID    uuid.UUID
+	Filename    string
+	Data        []byte
+	DateCreated time.Time
+}
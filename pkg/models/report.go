@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SalesSummary is the headline figures of the admin dashboard
+type SalesSummary struct {
+	Orders            int     `json:"orders"`
+	Revenue           float64 `json:"revenue"`
+	AverageOrderValue float64 `json:"average_order_value"`
+	ItemsSold         int     `json:"items_sold"`
+}
+
+// RevenuePoint is the revenue of one day, week or month
+type RevenuePoint struct {
+	Period  time.Time `json:"period"`
+	Orders  int       `json:"orders"`
+	Revenue float64   `json:"revenue"`
+}
+
+type ProductSales struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	Revenue     float64   `json:"revenue"`
+}
+
+type StatusCount struct {
+	Status string `json:"status"`
+	Orders int    `json:"orders"`
+}
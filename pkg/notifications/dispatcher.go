@@ -0,0 +1,99 @@
+package notifications
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// Dispatcher hands due emails from the outbox to the Sender. It is flushed
+// periodically by the job runner. Failed deliveries are retried with
+// exponential backoff until MaxAttempts is reached, after which the email is
+// marked as failed.
+type Dispatcher struct {
+	Outbox repository.OutboxStore
+	Sender Sender
+	// BatchSize sends at the sender's timeout should fit in the timeout of
+	// the job flushing the outbox, the emails a flush runs out of time for
+	// are released for the next one
+	BatchSize   int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	// ClaimTimeout is how long a claimed batch may take before other
+	// processes consider it abandoned and send it again. It must exceed the
+	// timeout of the job flushing the outbox, so only the batches of
+	// processes that died go stale.
+	ClaimTimeout time.Duration
+}
+
+func NewDispatcher(outbox repository.OutboxStore, sender Sender) *Dispatcher {
+	return &Dispatcher{
+		Outbox:       outbox,
+		Sender:       sender,
+		BatchSize:    8,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		ClaimTimeout: 15 * time.Minute,
+	}
+}
+
+// Flush attempts delivery of every email that is currently due. Once ctx is
+// done the emails left in the batch are released without counting an
+// attempt, including the one whose delivery ctx cut short.
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	emails, err := d.Outbox.ClaimDue(ctx, d.BatchSize, d.ClaimTimeout)
+	if err != nil {
+		return err
+	}
+
+	for i, email := range emails {
+		if ctx.Err() != nil {
+			d.release(ctx, emails[i:])
+			return nil
+		}
+
+		sendErr := d.Sender.Send(ctx, email.Recipient, email.Subject, email.Body)
+		if sendErr == nil {
+			if err := d.Outbox.MarkSent(context.WithoutCancel(ctx), email.EmailID); err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			d.release(ctx, emails[i:])
+			return nil
+		}
+
+		attempts := email.Attempts + 1
+		status := models.EmailStatusPending
+		if attempts >= d.MaxAttempts {
+			status = models.EmailStatusFailed
+		}
+		nextAttempt := time.Now().Add(d.backoff(attempts))
+
+		slog.WarnContext(ctx, "sending email failed", "email_id", email.EmailID, "recipient", email.Recipient, "attempt", attempts, "err", sendErr)
+		if err := d.Outbox.MarkFailed(ctx, email.EmailID, status, sendErr.Error(), nextAttempt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release hands the emails back to the outbox after ctx ended, the next
+// flush sends them
+func (d *Dispatcher) release(ctx context.Context, emails []models.Email) {
+	releaseCtx := context.WithoutCancel(ctx)
+	for _, email := range emails {
+		if err := d.Outbox.Release(releaseCtx, email.EmailID); err != nil {
+			slog.ErrorContext(ctx, "releasing email", "email_id", email.EmailID, "err", err)
+		}
+	}
+	slog.InfoContext(ctx, "flush interrupted, emails released", "count", len(emails), "err", ctx.Err())
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	return d.BaseBackoff * time.Duration(1<<(attempts-1))
+}
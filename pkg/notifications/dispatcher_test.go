@@ -0,0 +1,105 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository/memory"
+)
+
+// fakeSender records the recipients it delivered to, after calling before
+// with each of them
+type fakeSender struct {
+	before func(to string) error
+	sent   []string
+}
+
+func (s *fakeSender) Send(ctx context.Context, to, subject, htmlBody string) error {
+	if s.before != nil {
+		if err := s.before(to); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.sent = append(s.sent, to)
+	return nil
+}
+
+func enqueueEmails(t *testing.T, outbox *memory.Outbox, recipients ...string) {
+	t.Helper()
+	for _, recipient := range recipients {
+		if err := outbox.Enqueue(context.Background(), &models.Email{Recipient: recipient, Subject: "Hi", Body: "Hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func emailsByRecipient(outbox *memory.Outbox) map[string]models.Email {
+	emails := map[string]models.Email{}
+	for _, email := range outbox.Emails() {
+		emails[email.Recipient] = email
+	}
+	return emails
+}
+
+func TestFlushReleasesEmailsWhenInterrupted(t *testing.T) {
+	outbox := memory.NewOutbox()
+	enqueueEmails(t, outbox, "a@example.com", "b@example.com", "c@example.com")
+
+	//The job times out while the second email is being sent
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := &fakeSender{before: func(to string) error {
+		if to == "b@example.com" {
+			cancel()
+		}
+		return nil
+	}}
+
+	if err := NewDispatcher(outbox, sender).Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := emailsByRecipient(outbox)
+	if emails["a@example.com"].Status != models.EmailStatusSent {
+		t.Errorf("first email is %s", emails["a@example.com"].Status)
+	}
+	for _, recipient := range []string{"b@example.com", "c@example.com"} {
+		if email := emails[recipient]; email.Status != models.EmailStatusPending || email.Attempts != 0 {
+			t.Errorf("%s is %s after %d attempts, want pending without attempts", recipient, email.Status, email.Attempts)
+		}
+	}
+
+	//The next flush sends them
+	sender.before = nil
+	if err := NewDispatcher(outbox, sender).Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.sent) != 3 {
+		t.Errorf("sent %v", sender.sent)
+	}
+}
+
+func TestFlushRetriesFailedEmails(t *testing.T) {
+	outbox := memory.NewOutbox()
+	enqueueEmails(t, outbox, "a@example.com")
+
+	sender := &fakeSender{before: func(string) error { return errors.New("connection refused") }}
+	dispatcher := NewDispatcher(outbox, sender)
+	dispatcher.MaxAttempts = 2
+
+	if err := dispatcher.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	email := emailsByRecipient(outbox)["a@example.com"]
+	if email.Status != models.EmailStatusPending || email.Attempts != 1 || email.LastError != "connection refused" {
+		t.Fatalf("after one failure: %+v", email)
+	}
+	if !email.NextAttemptAt.After(email.DateCreated) {
+		t.Error("the retry was not backed off")
+	}
+}
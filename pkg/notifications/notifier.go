@@ -0,0 +1,81 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"log/slog"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// Notifier renders transactional emails and queues them in the outbox. The
+// Dispatcher takes care of the actual delivery.
+type Notifier struct {
+	Outbox repository.OutboxStore
+	tmpl   *template.Template
+}
+
+// NewNotifier renders emails with tmpl, the templates the handlers parsed,
+// which include those under templates/email
+func NewNotifier(outbox repository.OutboxStore, tmpl *template.Template) *Notifier {
+	return &Notifier{
+		Outbox: outbox,
+		tmpl:   tmpl,
+	}
+}
+
+func (n *Notifier) OrderConfirmation(ctx context.Context, order *models.Order) error {
+	data := struct {
+		Order     *models.Order
+		TotalCost float64
+	}{
+		Order:     order,
+		TotalCost: order.Total,
+	}
+	return n.enqueue(ctx, order.Customer.Email, "Your order has been placed", "emailOrderConfirmation", data)
+}
+
+func (n *Notifier) OrderStatusChanged(ctx context.Context, order *models.Order) error {
+	data := struct {
+		Order *models.Order
+	}{
+		Order: order,
+	}
+	return n.enqueue(ctx, order.Customer.Email, "Your order is now "+order.OrderStatus, "emailOrderStatus", data)
+}
+
+// PasswordReset sends the link that lets the owner of email choose a new
+// password. The caller issues the token in resetURL and decides when it
+// expires, the email only tells the recipient.
+func (n *Notifier) PasswordReset(ctx context.Context, email, resetURL string, expires time.Time) error {
+	data := struct {
+		ResetURL string
+		Expires  time.Time
+	}{
+		ResetURL: resetURL,
+		Expires:  expires,
+	}
+	return n.enqueue(ctx, email, "Reset your password", "emailPasswordReset", data)
+}
+
+func (n *Notifier) enqueue(ctx context.Context, recipient, subject, templateName string, data any) error {
+	//Orders placed before checkout asked for an email have nobody to notify
+	if recipient == "" {
+		slog.InfoContext(ctx, "email skipped, no recipient", "template", templateName)
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := n.tmpl.ExecuteTemplate(&body, templateName, data); err != nil {
+		return err
+	}
+
+	return n.Outbox.Enqueue(ctx, &models.Email{
+		Recipient: recipient,
+		Subject:   subject,
+		Body:      body.String(),
+	})
+}
@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"context"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository/memory"
+)
+
+func newTestNotifier(t *testing.T) (*Notifier, *memory.Outbox) {
+	t.Helper()
+	tmpl, err := template.ParseGlob(filepath.Join("..", "..", "templates", "email", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := memory.NewOutbox()
+	return NewNotifier(outbox, tmpl), outbox
+}
+
+func TestNotifierEmails(t *testing.T) {
+	order := &models.Order{
+		OrderID:     uuid.New(),
+		Customer:    models.Customer{Email: "ada@example.com", Name: "Ada Lovelace"},
+		OrderStatus: "delivered",
+		OrderDate:   time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Items:       []models.OrderItem{{Product: models.Product{ProductName: "Mug", Price: 10}, Quantity: 2, Cost: 20}},
+		Total:       20,
+	}
+	expires := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		send    func(n *Notifier) error
+		subject string
+		body    []string
+	}{
+		{
+			name:    "confirmation",
+			send:    func(n *Notifier) error { return n.OrderConfirmation(context.Background(), order) },
+			subject: "Your order has been placed",
+			body:    []string{order.OrderID.String(), "Mug", "$20.00"},
+		},
+		{
+			name:    "status",
+			send:    func(n *Notifier) error { return n.OrderStatusChanged(context.Background(), order) },
+			subject: "Your order is now delivered",
+			body:    []string{order.OrderID.String(), "<b>delivered</b>"},
+		},
+		{
+			name: "password reset",
+			send: func(n *Notifier) error {
+				return n.PasswordReset(context.Background(), "ada@example.com", "https://shop.test/reset?token=a&b", expires)
+			},
+			subject: "Reset your password",
+			body:    []string{`href="https://shop.test/reset?token=a&amp;b"`, "01 Mar 2024 11:00 UTC"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, outbox := newTestNotifier(t)
+			if err := tt.send(n); err != nil {
+				t.Fatal(err)
+			}
+
+			emails := outbox.Emails()
+			if len(emails) != 1 {
+				t.Fatalf("%d emails queued, want 1", len(emails))
+			}
+			email := emails[0]
+			if email.Recipient != "ada@example.com" || email.Subject != tt.subject {
+				t.Errorf("email to %q about %q", email.Recipient, email.Subject)
+			}
+			for _, want := range tt.body {
+				if !strings.Contains(email.Body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifierSkipsMissingRecipient(t *testing.T) {
+	n, outbox := newTestNotifier(t)
+	if err := n.OrderConfirmation(context.Background(), &models.Order{OrderID: uuid.New()}); err != nil {
+		t.Fatal(err)
+	}
+	if emails := outbox.Emails(); len(emails) != 0 {
+		t.Errorf("%d emails queued for an order without email", len(emails))
+	}
+}
@@ -0,0 +1,167 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/security"
+)
+
+// Scopes a rule limits clients by
+const (
+	ScopeIP      = "ip"
+	ScopeSession = "session"
+)
+
+// DefaultRule applies to routes that weren't given a rule of their own
+const DefaultRule = "default"
+
+// Rule limits each client IP and each session separately. Sessions are
+// stricter, while an IP may be shared by many visitors behind a NAT.
+type Rule struct {
+	IP      Limit
+	Session Limit
+}
+
+// Rejection tells the handler of a limited request which bucket ran out
+type Rejection struct {
+	Rule       string
+	Scope      string
+	RetryAfter time.Duration
+}
+
+type rejectionKey struct{}
+
+// Limiter applies rules to the routes of a mux router
+type Limiter struct {
+	Store Store
+	// SessionKey signs the session cookies the limiter hands out. Instances
+	// sharing a Store need the same key, NewLimiter picks a random one.
+	// Requests without a valid session are only limited by IP.
+	SessionKey []byte
+	// TrustProxy takes the client IP from X-Forwarded-For, only enable it
+	// behind a proxy that sets the header
+	TrustProxy bool
+	// Skip exempts requests, e.g. probes and static files
+	Skip func(*http.Request) bool
+
+	rules  map[string]Rule
+	routes map[string]string
+}
+
+func NewLimiter(store Store, rules map[string]Rule) *Limiter {
+	return &Limiter{
+		Store:      store,
+		SessionKey: newSessionKey(),
+		rules:      rules,
+		routes:     map[string]string{},
+	}
+}
+
+// Route applies rule to the routes with the given path templates
+func (l *Limiter) Route(rule string, templates ...string) {
+	for _, template := range templates {
+		l.routes[template] = rule
+	}
+}
+
+// Middleware returns middleware that takes a token from the buckets of the
+// client and passes requests finding one empty to onLimited, RejectionOf
+// tells it which. A failing Store lets requests through.
+func (l *Limiter) Middleware(onLimited http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.Skip != nil && l.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			name := l.ruleFor(r)
+			rule := l.rules[name]
+			now := time.Now()
+
+			//The IP goes first, a request it rejects doesn't use up the
+			//tokens of the session as well
+			if rejection, ok := l.take(r.Context(), name, ScopeIP, security.ClientIP(r, l.TrustProxy), rule.IP, now); !ok {
+				l.reject(w, r, onLimited, rejection)
+				return
+			}
+			if !rule.Session.Unlimited() {
+				if session, ok := l.session(r); !ok {
+					//A new session starts with a full bucket
+					l.startSession(w, r)
+				} else if rejection, ok := l.take(r.Context(), name, ScopeSession, session, rule.Session, now); !ok {
+					l.reject(w, r, onLimited, rejection)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *Limiter) ruleFor(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if name, ok := l.routes[template]; ok {
+				return name
+			}
+		}
+	}
+	return DefaultRule
+}
+
+func (l *Limiter) take(ctx context.Context, rule, scope, client string, limit Limit, now time.Time) (Rejection, bool) {
+	if limit.Unlimited() {
+		return Rejection{}, true
+	}
+
+	key := rule + ":" + scope + ":" + client
+	ok, wait, err := l.Store.Take(ctx, key, limit, now)
+	if err != nil {
+		slog.ErrorContext(ctx, "rate limiting", "rule", rule, "scope", scope, "err", err)
+		return Rejection{}, true
+	}
+	return Rejection{Rule: rule, Scope: scope, RetryAfter: wait}, ok
+}
+
+func (l *Limiter) reject(w http.ResponseWriter, r *http.Request, onLimited http.Handler, rejection Rejection) {
+	r = r.WithContext(context.WithValue(r.Context(), rejectionKey{}, rejection))
+	onLimited.ServeHTTP(w, r)
+}
+
+// Run prunes the refilled buckets every minute until ctx is done
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := l.Store.Prune(ctx, now.Add(-l.longestPeriod())); err != nil {
+				slog.ErrorContext(ctx, "pruning rate limits", "err", err)
+			}
+		}
+	}
+}
+
+// longestPeriod is the longest any bucket takes to refill
+func (l *Limiter) longestPeriod() time.Duration {
+	var longest time.Duration
+	for _, rule := range l.rules {
+		longest = max(longest, rule.IP.Per, rule.Session.Per)
+	}
+	return longest
+}
+
+// RejectionOf returns the bucket that ran out for the request passed to the
+// onLimited handler
+func RejectionOf(r *http.Request) Rejection {
+	rejection, _ := r.Context().Value(rejectionKey{}).(Rejection)
+	return rejection
+}
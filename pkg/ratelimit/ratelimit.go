@@ -0,0 +1,111 @@
+// Package ratelimit throttles clients with token buckets, one per rule and
+// client IP or session. Buckets live in memory, or in a Store shared between
+// instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit lets Requests through at once, then refills evenly over Per. The zero
+// Limit doesn't limit anything.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit reads a limit written as requests/period, e.g. "30/1m"
+func ParseLimit(s string) (Limit, error) {
+	requests, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: expected requests/period", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid number of requests", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+	return Limit{Requests: n, Per: d}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// Unlimited reports whether l lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// Take takes a token from a bucket that held tokens at last, refilling it up
+// to now first. It returns what the bucket holds afterwards and, when it was
+// empty, how long until the next token.
+func (l Limit) Take(tokens float64, last, now time.Time) (float64, bool, time.Duration) {
+	rate := float64(l.Requests) / l.Per.Seconds()
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens = math.Min(float64(l.Requests), tokens+elapsed.Seconds()*rate)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) / rate * float64(time.Second))
+}
+
+// Store keeps the buckets. A missing bucket is full.
+type Store interface {
+	// Take takes a token from the bucket key, see Limit.Take
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error)
+	// Prune drops the buckets untouched since before, they have refilled
+	Prune(ctx context.Context, before time.Time) error
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps the buckets of a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = bucket{tokens: float64(limit.Requests), last: now}
+	}
+	tokens, allowed, wait := limit.Take(b.tokens, b.last, now)
+	if allowed {
+		s.buckets[key] = bucket{tokens: tokens, last: now}
+	}
+	return allowed, wait, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.last.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "30/1m", want: Limit{Requests: 30, Per: time.Minute}},
+		{in: " 5/10s ", want: Limit{Requests: 5, Per: 10 * time.Second}},
+		{in: "0/1h", want: Limit{Requests: 0, Per: time.Hour}},
+		{in: "30", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "30/soon", wantErr: true},
+		{in: "30/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Requests: 10, Per: 10 * time.Second}
+	last := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		wantOK     bool
+		wantWait   time.Duration
+	}{
+		{name: "full", tokens: 10, wantTokens: 9, wantOK: true},
+		{name: "last token", tokens: 1, wantTokens: 0, wantOK: true},
+		{name: "empty", tokens: 0, wantTokens: 0, wantWait: time.Second},
+		{name: "half a token", tokens: 0.5, wantTokens: 0.5, wantWait: 500 * time.Millisecond},
+		{name: "refilled", tokens: 0, elapsed: 3 * time.Second, wantTokens: 2, wantOK: true},
+		{name: "refill is capped", tokens: 5, elapsed: time.Hour, wantTokens: 9, wantOK: true},
+		{name: "clock went back", tokens: 0, elapsed: -time.Minute, wantTokens: 0, wantWait: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, ok, wait := limit.Take(tt.tokens, last, last.Add(tt.elapsed))
+			if tokens != tt.wantTokens || ok != tt.wantOK || wait != tt.wantWait {
+				t.Errorf("Take = %v, %v, %v, want %v, %v, %v", tokens, ok, wait, tt.wantTokens, tt.wantOK, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Per: time.Minute}
+	now := time.Now()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.Take(ctx, "a", limit, now); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+	ok, wait, _ := store.Take(ctx, "a", limit, now)
+	if ok || wait != 30*time.Second {
+		t.Errorf("third request: ok %v, wait %v", ok, wait)
+	}
+	if ok, _, _ := store.Take(ctx, "b", limit, now); !ok {
+		t.Error("buckets are not separate")
+	}
+	if ok, _, _ := store.Take(ctx, "a", limit, now.Add(30*time.Second)); !ok {
+		t.Error("the bucket did not refill")
+	}
+
+	//Pruned buckets start full again
+	if err := store.Prune(ctx, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.buckets) != 0 {
+		t.Errorf("%d buckets left after pruning", len(store.buckets))
+	}
+}
+
+// newTestLimiter serves /login under the "login" rule and everything else
+// under the default rule. Limited requests get a 429 with the rejection in
+// its headers, Retry-After in whole seconds as handlers.RateLimited sends it.
+func newTestLimiter(rules map[string]Rule) (*Limiter, http.Handler) {
+	l := NewLimiter(NewMemoryStore(), rules)
+	l.Route("login", "/login")
+
+	onLimited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejection := RejectionOf(r)
+		w.Header().Set("X-Rule", rejection.Rule)
+		w.Header().Set("X-Scope", rejection.Scope)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rejection.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	router := mux.NewRouter()
+	router.Use(l.Middleware(onLimited))
+	router.Handle("/login", ok)
+	router.Handle("/", ok)
+	return l, router
+}
+
+func request(handler http.Handler, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SessionCookie {
+			return cookie
+		}
+	}
+	t.Fatal("no session cookie")
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	minute := func(n int) Limit { return Limit{Requests: n, Per: time.Minute} }
+
+	tests := []struct {
+		name string
+		rule Rule
+		path string
+		//requests are made with the session of the first one, the last
+		//is limited
+		requests  int
+		wantRule  string
+		wantScope string
+		wantRetry string
+	}{
+		{name: "ip", rule: Rule{IP: minute(2), Session: minute(10)}, path: "/", requests: 3, wantRule: DefaultRule, wantScope: ScopeIP, wantRetry: "30"},
+		{name: "session", rule: Rule{IP: minute(10), Session: minute(2)}, path: "/", requests: 4, wantRule: DefaultRule, wantScope: ScopeSession, wantRetry: "30"},
+		{name: "route rule", rule: Rule{IP: minute(1)}, path: "/login", requests: 2, wantRule: "login", wantScope: ScopeIP, wantRetry: "60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := map[string]Rule{DefaultRule: {}}
+			if tt.wantRule == DefaultRule {
+				rules[DefaultRule] = tt.rule
+			} else {
+				rules[tt.wantRule] = tt.rule
+			}
+			_, handler := newTestLimiter(rules)
+
+			var cookie *http.Cookie
+			for i := 1; i < tt.requests; i++ {
+				w := request(handler, tt.path, cookie)
+				if w.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d", i, w.Code)
+				}
+				if cookie == nil && !tt.rule.Session.Unlimited() {
+					cookie = sessionCookie(t, w)
+				}
+			}
+
+			w := request(handler, tt.path, cookie)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("last request: status %d", w.Code)
+			}
+			if rule, scope := w.Header().Get("X-Rule"), w.Header().Get("X-Scope"); rule != tt.wantRule || scope != tt.wantScope {
+				t.Errorf("limited by %s/%s, want %s/%s", rule, scope, tt.wantRule, tt.wantScope)
+			}
+			if retry := w.Header().Get("Retry-After"); retry != tt.wantRetry {
+				t.Errorf("Retry-After %s, want %s", retry, tt.wantRetry)
+			}
+		})
+	}
+}
+
+// TestMiddlewareIPFirst checks that a request the IP limit rejects leaves the
+// session's tokens alone
+func TestMiddlewareIPFirst(t *testing.T) {
+	l, handler := newTestLimiter(map[string]Rule{DefaultRule: {
+		IP:      Limit{Requests: 2, Per: time.Minute},
+		Session: Limit{Requests: 10, Per: time.Minute},
+	}})
+
+	//The first request starts the session without taking from it
+	cookie := sessionCookie(t, request(handler, "/", nil))
+	request(handler, "/", cookie)
+	for i := 0; i < 3; i++ {
+		if w := request(handler, "/", cookie); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("status %d past the IP limit", w.Code)
+		}
+	}
+
+	session, ok := l.session(sessionRequest(cookie))
+	if !ok {
+		t.Fatal("the session cookie is not valid")
+	}
+	store := l.Store.(*MemoryStore)
+	if b := store.buckets[DefaultRule+":"+ScopeSession+":"+session]; b.tokens != 9 {
+		t.Errorf("the session holds %v tokens, want 9", b.tokens)
+	}
+}
+
+func sessionRequest(cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	return r
+}
+
+func TestSessionCookie(t *testing.T) {
+	l, handler := newTestLimiter(map[string]Rule{DefaultRule: {Session: Limit{Requests: 1, Per: time.Minute}}})
+
+	cookie := sessionCookie(t, request(handler, "/", nil))
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != sessionMaxAge {
+		t.Errorf("cookie %+v", cookie)
+	}
+	id, ok := l.session(sessionRequest(cookie))
+	if !ok {
+		t.Fatal("the limiter rejects its own cookie")
+	}
+
+	other := NewLimiter(NewMemoryStore(), nil)
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "unsigned", value: id},
+		{name: "other id", value: "x" + id[1:] + "." + l.sign(id)},
+		{name: "other signature", value: id + "." + l.sign("x")},
+		{name: "other key", value: id + "." + other.sign(id)},
+		{name: "empty", value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forged := &http.Cookie{Name: SessionCookie, Value: tt.value}
+			if _, ok := l.session(sessionRequest(forged)); ok {
+				t.Fatal("the forged session was accepted")
+			}
+
+			//A forged cookie gets a new session instead of the bucket
+			//it names
+			w := request(handler, "/", forged)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+			if renewed := sessionCookie(t, w); renewed.Value == cookie.Value {
+				t.Error("the forged cookie was answered with the original session")
+			}
+		})
+	}
+
+	//The genuine session still has its token
+	if w := request(handler, "/", cookie); w.Code != http.StatusOK {
+		t.Errorf("the session was spent by forged cookies, status %d", w.Code)
+	}
+	if w := request(handler, "/", cookie); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d past the session limit", w.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// SessionCookie holds the visitor's session, a random ID signed with the
+// limiter's SessionKey. Clients can't choose or forge one, so they can't
+// spend the tokens of someone else's session or spread their requests over
+// sessions they made up.
+const SessionCookie = "rl_session"
+
+const (
+	sessionIDLength = 16
+	sessionMaxAge   = 30 * 24 * 60 * 60
+)
+
+// newSessionKey returns a random key, its sessions only last as long as the
+// process
+func newSessionKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// session returns the session of the request, if it has a validly signed one
+func (l *Limiter) session(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+	id, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(l.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// startSession gives the visitor a new session with the response
+func (l *Limiter) startSession(w http.ResponseWriter, r *http.Request) {
+	raw := make([]byte, sessionIDLength)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id + "." + l.sign(id),
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (l *Limiter) sign(id string) string {
+	mac := hmac.New(sha256.New, l.SessionKey)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+type AuditRepository struct {
+	DB *DB
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{DB: db}
+}
+
+// AuditFilter narrows the audit trail, zero fields match everything
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   string
+	DateFrom   time.Time
+	DateTo     time.Time
+	Limit      int
+	Offset     int
+}
+
+func (f AuditFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if f.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, f.EntityType)
+	}
+	if f.EntityID != "" {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, f.EntityID)
+	}
+	if !f.DateFrom.IsZero() {
+		conditions = append(conditions, "date_created >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if !f.DateTo.IsZero() {
+		conditions = append(conditions, "date_created < ?")
+		args = append(args, f.DateTo)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+type auditKey struct{}
+
+// WithAudit returns a context whose changes the stores record in the audit
+// log, as entry.Action by entry.Actor. Each store writes the entry in the
+// same transaction as the change, so neither is kept without the other.
+// Changes made without it, e.g. by jobs, are not audited.
+func WithAudit(ctx context.Context, entry models.AuditEntry) context.Context {
+	return context.WithValue(ctx, auditKey{}, entry)
+}
+
+// AuditFrom returns the audit entry WithAudit attached to ctx
+func AuditFrom(ctx context.Context) (models.AuditEntry, bool) {
+	entry, ok := ctx.Value(auditKey{}).(models.AuditEntry)
+	return entry, ok
+}
+
+// recordAudit records a change to one entity if ctx is audited, empty
+// changes are skipped
+func recordAudit(ctx context.Context, q execer, entityType, entityID string, changes models.Changes) error {
+	entry, ok := AuditFrom(ctx)
+	if !ok || len(changes) == 0 {
+		return nil
+	}
+	entry.EntityType = entityType
+	entry.EntityID = entityID
+	entry.Changes = changes
+	return insertAudit(ctx, q, &entry)
+}
+
+func (r *AuditRepository) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "audit.record")
+	defer cancel()
+
+	return insertAudit(ctx, r.DB, entry)
+}
+
+func insertAudit(ctx context.Context, q execer, entry *models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	entry.AuditID = uuid.New()
+	entry.DateCreated = time.Now()
+
+	query := `INSERT INTO audit_log (audit_id, actor, remote_ip, request_id, action, entity_type, entity_id, changes, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = q.ExecContext(ctx, query,
+		entry.AuditID,
+		entry.Actor,
+		entry.RemoteIP,
+		entry.RequestID,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		string(changes),
+		entry.DateCreated,
+	)
+	return err
+}
+
+func (r *AuditRepository) SearchAudit(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "audit.search")
+	defer cancel()
+
+	where, args := filter.where()
+	query := `SELECT audit_id, actor, remote_ip, request_id, action, entity_type, entity_id, changes, date_created FROM audit_log` + where + ` ORDER BY date_created DESC, audit_id`
+	//A zero limit returns every matching entry
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes string
+		err := rows.Scan(
+			&entry.AuditID,
+			&entry.Actor,
+			&entry.RemoteIP,
+			&entry.RequestID,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&changes,
+			&entry.DateCreated,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *AuditRepository) CountAudit(ctx context.Context, filter AuditFilter) (int, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "audit.count")
+	defer cancel()
+
+	where, args := filter.where()
+
+	var count int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
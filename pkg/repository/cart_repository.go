@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+type CartRepository struct {
+	DB *DB
+}
+
+func NewCartRepository(db *DB) *CartRepository {
+	return &CartRepository{DB: db}
+}
+
+func (r *CartRepository) GetCart(ctx context.Context, cartID uuid.UUID) ([]models.OrderItem, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "cart.get")
+	defer cancel()
+
+	query := `
+		SELECT c.quantity, p.product_id, COALESCE(p.sku, ''), p.product_name, p.price, p.description,
+			p.product_image, p.category, p.archived, p.date_created, p.date_modified
+		FROM cart_items c
+		JOIN products p ON p.product_id = c.product_id
+		WHERE c.cart_id = ?
+		ORDER BY c.date_added, c.product_id`
+
+	rows, err := r.DB.QueryContext(ctx, query, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		var product models.Product
+		err := rows.Scan(
+			&item.Quantity,
+			&product.ProductID,
+			&product.SKU,
+			&product.ProductName,
+			&product.Price,
+			&product.Description,
+			&product.ProductImage,
+			&product.Category,
+			&product.Archived,
+			&product.DateCreated,
+			&product.DateModified,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.OrderID = cartID
+		item.ProductID = product.ProductID
+		item.Product = product
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *CartRepository) AddItem(ctx context.Context, cartID, productID uuid.UUID) (bool, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "cart.add")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM cart_items WHERE cart_id = ? AND product_id = ?`, cartID, productID).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO cart_items (cart_id, product_id, quantity, date_added) VALUES (?, ?, ?, ?)`, cartID, productID, 1, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *CartRepository) SetQuantity(ctx context.Context, cartID, productID uuid.UUID, quantity int) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "cart.set_quantity")
+	defer cancel()
+
+	if quantity <= 0 {
+		_, err := r.DB.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = ? AND product_id = ?`, cartID, productID)
+		return err
+	}
+
+	_, err := r.DB.ExecContext(ctx, `UPDATE cart_items SET quantity = ? WHERE cart_id = ? AND product_id = ?`, quantity, cartID, productID)
+	return err
+}
+
+func (r *CartRepository) ClearCart(ctx context.Context, cartID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "cart.clear")
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = ?`, cartID)
+	return err
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTimeouts are used until the configuration overrides them. Imports,
+// bulk actions and reports scan many rows and get more time, migrations are
+// not cut off at all.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Default: 5 * time.Second,
+		Operations: map[string]time.Duration{
+			"product.import":      time.Minute,
+			"product.bulk":        30 * time.Second,
+			"report.summary":      30 * time.Second,
+			"report.revenue":      30 * time.Second,
+			"report.top_products": 30 * time.Second,
+			"report.statuses":     30 * time.Second,
+			"schema.migrate":      0,
+			"ratelimit.take":      500 * time.Millisecond,
+		},
+	}
+}
+
+// Timeouts sets how long each repository operation may run. Operations are
+// named after the store and method, e.g. "product.search" or "report.revenue".
+type Timeouts struct {
+	Default    time.Duration
+	Operations map[string]time.Duration
+}
+
+// For returns the timeout of op, zero means no deadline
+func (t Timeouts) For(op string) time.Duration {
+	if timeout, ok := t.Operations[op]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// DB is a database handle that speaks a dialect. Use the Context methods,
+// they rebind queries before sending them.
+type DB struct {
+	*sql.DB
+	Dialect  Dialect
+	Timeouts Timeouts
+}
+
+// Open connects to the database and checks that it is reachable. For an
+// in-memory SQLite database the pool is limited to one connection, as every
+// connection would otherwise get its own empty database.
+func Open(ctx context.Context, driver, dsn string) (*DB, error) {
+	dialect, err := DialectByName(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect.Name == SQLite.Name && strings.Contains(dsn, ":memory:") {
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db, Dialect: dialect, Timeouts: DefaultTimeouts()}, nil
+}
+
+type opKey struct{}
+
+var tracer = otel.Tracer("github.com/snipep/Ecommerce-application/pkg/repository")
+
+// withTimeout derives the context an operation runs under and starts its
+// span. The caller's deadline still applies if it is sooner. The operation
+// name is kept in the context so failed queries can be logged with it.
+func (db *DB) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, opKey{}, op)
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(dbSystem(db.Dialect)))
+
+	var cancel context.CancelFunc
+	if timeout := db.Timeouts.For(op); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
+
+// dbSystem names the dialect in the OpenTelemetry conventions
+func dbSystem(d Dialect) attribute.KeyValue {
+	switch d.Name {
+	case Postgres.Name:
+		return semconv.DBSystemPostgreSQL
+	case SQLite.Name:
+		return semconv.DBSystemSqlite
+	default:
+		return semconv.DBSystemMySQL
+	}
+}
+
+// startQuery starts the span of a single statement. The returned function
+// records how the statement went: its timing, a log line if it failed, along
+// with the operation and request it belongs to, and the span status. Missing
+// rows are an expected outcome and aren't treated as failures.
+func startQuery(ctx context.Context, dialect Dialect, query string) (context.Context, func(error)) {
+	start := time.Now()
+	op, _ := ctx.Value(opKey{}).(string)
+	statement := strings.Join(strings.Fields(query), " ")
+	verb, _, _ := strings.Cut(statement, " ")
+
+	ctx, span := tracer.Start(ctx, strings.ToUpper(verb),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			dbSystem(dialect),
+			semconv.DBOperationName(op),
+			semconv.DBQueryText(statement),
+		),
+	)
+
+	return ctx, func(err error) {
+		defer span.End()
+		metrics.ObserveQuery(op, time.Since(start), err)
+
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		//Unique violations are reported to the user as conflicts, migrations
+		//skip what already exists
+		level := slog.LevelError
+		if isUniqueViolation(err) || isAlreadyExists(err) {
+			level = slog.LevelWarn
+		}
+		slog.Log(ctx, level, "database error",
+			"op", op,
+			"dialect", dialect.Name,
+			"query", statement,
+			"err", err,
+		)
+	}
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, done := startQuery(ctx, db.Dialect, query)
+	result, err := db.DB.ExecContext(ctx, db.Dialect.Rebind(query), db.Dialect.args(args)...)
+	done(err)
+	return result, err
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, done := startQuery(ctx, db.Dialect, query)
+	rows, err := db.DB.QueryContext(ctx, db.Dialect.Rebind(query), db.Dialect.args(args)...)
+	done(err)
+	return rows, err
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, done := startQuery(ctx, db.Dialect, query)
+	row := db.DB.QueryRowContext(ctx, db.Dialect.Rebind(query), db.Dialect.args(args)...)
+	done(row.Err())
+	return row
+}
+
+func (db *DB) BeginTx(ctx context.Context) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		_, done := startQuery(ctx, db.Dialect, "BEGIN")
+		done(err)
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+// Tx is a transaction that speaks a dialect, see DB
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, done := startQuery(ctx, tx.Dialect, query)
+	result, err := tx.Tx.ExecContext(ctx, tx.Dialect.Rebind(query), tx.Dialect.args(args)...)
+	done(err)
+	return result, err
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, done := startQuery(ctx, tx.Dialect, query)
+	rows, err := tx.Tx.QueryContext(ctx, tx.Dialect.Rebind(query), tx.Dialect.args(args)...)
+	done(err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, done := startQuery(ctx, tx.Dialect, query)
+	row := tx.Tx.QueryRowContext(ctx, tx.Dialect.Rebind(query), tx.Dialect.args(args)...)
+	done(row.Err())
+	return row
+}
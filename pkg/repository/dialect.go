@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Dialect describes how a database differs from the MySQL flavoured SQL the
+// repositories are written in. Queries use ? placeholders and portable
+// syntax, the dialect only rewrites what can't be avoided.
+type Dialect struct {
+	Name string
+	// Driver is the database/sql driver registered for the dialect
+	Driver string
+	// numbered placeholders, $1, $2... instead of ?
+	numberedPlaceholders bool
+	// ddl rewrites column types in migrations
+	ddl *strings.Replacer
+	// utcTimes stores every time in UTC. SQLite keeps times as text, which
+	// only compares correctly when they share a time zone.
+	utcTimes bool
+}
+
+var (
+	MySQL = Dialect{
+		Name:   "mysql",
+		Driver: "mysql",
+		ddl:    strings.NewReplacer("INDEX IF NOT EXISTS", "INDEX", "ADD COLUMN IF NOT EXISTS", "ADD COLUMN"),
+	}
+	Postgres = Dialect{
+		Name:                 "postgres",
+		Driver:               "pgx",
+		numberedPlaceholders: true,
+		ddl:                  strings.NewReplacer("DATETIME", "TIMESTAMP", "LONGTEXT", "TEXT"),
+	}
+	SQLite = Dialect{
+		Name:     "sqlite",
+		Driver:   "sqlite",
+		ddl:      strings.NewReplacer("ADD COLUMN IF NOT EXISTS", "ADD COLUMN"),
+		utcTimes: true,
+	}
+)
+
+var dialects = map[string]Dialect{
+	MySQL.Name:    MySQL,
+	Postgres.Name: Postgres,
+	SQLite.Name:   SQLite,
+}
+
+// DialectByName returns the dialect for a DATABASE_DRIVER setting
+func DialectByName(name string) (Dialect, error) {
+	dialect, ok := dialects[strings.ToLower(name)]
+	if !ok {
+		return Dialect{}, fmt.Errorf("unsupported database driver %q, use mysql, postgres or sqlite", name)
+	}
+	return dialect, nil
+}
+
+// Rebind rewrites the ? placeholders of query for the dialect. Question
+// marks inside string literals are left alone.
+func (d Dialect) Rebind(query string) string {
+	if !d.numberedPlaceholders || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// args converts query arguments the database can't store as they are
+func (d Dialect) args(args []any) []any {
+	if !d.utcTimes {
+		return args
+	}
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = t.UTC()
+		}
+		converted[i] = arg
+	}
+	return converted
+}
+
+// isAlreadyExists reports whether a migration statement failed because the
+// index or column it creates exists, on the dialects whose ddl drops the IF
+// NOT EXISTS clause of the statement
+func isAlreadyExists(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		//Duplicate column name, duplicate key name
+		return mysqlErr.Number == 1060 || mysqlErr.Number == 1061
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_ERROR && strings.Contains(sqliteErr.Error(), "duplicate column name")
+	}
+	return false
+}
+
+// isUniqueViolation reports whether err was caused by a unique index, in
+// any of the supported databases
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+	return false
+}
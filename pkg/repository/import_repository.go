@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// ImportRepository keeps catalog uploads between their preview and
+// confirmation, so any instance can confirm an import another one previewed
+type ImportRepository struct {
+	DB *DB
+}
+
+func NewImportRepository(db *DB) *ImportRepository {
+	return &ImportRepository{DB: db}
+}
+
+func (r *ImportRepository) SaveImport(ctx context.Context, pending *models.ProductImport) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "import.save")
+	defer cancel()
+
+	pending.ImportID = uuid.New()
+	pending.DateCreated = time.Now()
+
+	query := `INSERT INTO product_imports (import_id, filename, data, date_created) VALUES (?, ?, ?, ?)`
+	_, err := r.DB.ExecContext(ctx, query, pending.ImportID, pending.Filename, string(pending.Data), pending.DateCreated)
+	return err
+}
+
+func (r *ImportRepository) GetImport(ctx context.Context, importID uuid.UUID) (*models.ProductImport, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "import.get")
+	defer cancel()
+
+	query := `SELECT import_id, filename, data, date_created FROM product_imports WHERE import_id = ?`
+
+	var pending models.ProductImport
+	var data string
+	err := r.DB.QueryRowContext(ctx, query, importID).Scan(&pending.ImportID, &pending.Filename, &data, &pending.DateCreated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	pending.Data = []byte(data)
+	return &pending, nil
+}
+
+func (r *ImportRepository) DeleteImport(ctx context.Context, importID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "import.delete")
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM product_imports WHERE import_id = ?`, importID)
+	return err
+}
+
+func (r *ImportRepository) PurgeImports(ctx context.Context, age time.Duration) (int64, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "import.purge")
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM product_imports WHERE date_created < ?`, time.Now().Add(-age))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
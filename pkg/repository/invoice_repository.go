@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+type InvoiceRepository struct {
+	DB *DB
+}
+
+func NewInvoiceRepository(db *DB) *InvoiceRepository {
+	return &InvoiceRepository{DB: db}
+}
+
+func (r *InvoiceRepository) GetInvoiceByOrderID(ctx context.Context, orderID uuid.UUID) (*models.Invoice, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "invoice.get")
+	defer cancel()
+
+	query := `SELECT invoice_number, order_id, subtotal, tax_rate, tax, shipping, total, issued_at FROM invoices WHERE order_id = ?`
+
+	var invoice models.Invoice
+	err := r.DB.QueryRowContext(ctx, query, orderID).Scan(
+		&invoice.InvoiceNumber,
+		&invoice.OrderID,
+		&invoice.Subtotal,
+		&invoice.TaxRate,
+		&invoice.Tax,
+		&invoice.Shipping,
+		&invoice.Total,
+		&invoice.IssuedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// IssueInvoice stores invoice under the next invoice number. If the order
+// already has an invoice, that one is returned instead, so an order is never
+// billed twice.
+func (r *InvoiceRepository) IssueInvoice(ctx context.Context, invoice *models.Invoice) (*models.Invoice, error) {
+	existing, err := r.GetInvoiceByOrderID(ctx, invoice.OrderID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	invoice.IssuedAt = time.Now()
+
+	// Two requests can pick the same number, in which case the primary key
+	// rejects one of them and it tries again with the next number
+	for attempt := 0; attempt < 3; attempt++ {
+		err = r.insertNextInvoice(ctx, invoice)
+		if err == nil {
+			return invoice, nil
+		}
+
+		if existing, getErr := r.GetInvoiceByOrderID(ctx, invoice.OrderID); getErr == nil {
+			return existing, nil
+		}
+	}
+	return nil, err
+}
+
+func (r *InvoiceRepository) insertNextInvoice(ctx context.Context, invoice *models.Invoice) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "invoice.issue")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(invoice_number), 0) + 1 FROM invoices`).Scan(&invoice.InvoiceNumber); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `INSERT INTO invoices (invoice_number, order_id, subtotal, tax_rate, tax, shipping, total, issued_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		invoice.InvoiceNumber,
+		invoice.OrderID,
+		invoice.Subtotal,
+		invoice.TaxRate,
+		invoice.Tax,
+		invoice.Shipping,
+		invoice.Total,
+		invoice.IssuedAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+type JobRepository struct {
+	DB *DB
+}
+
+func NewJobRepository(db *DB) *JobRepository {
+	return &JobRepository{DB: db}
+}
+
+func (r *JobRepository) Enqueue(ctx context.Context, job *models.Job) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.enqueue")
+	defer cancel()
+
+	query := `INSERT INTO jobs (job_id, job_type, payload, status, attempts, max_attempts, run_at, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	job.JobID = uuid.New()
+	job.Status = models.JobStatusPending
+	job.DateCreated = time.Now()
+	job.DateModified = job.DateCreated
+	if job.RunAt.IsZero() {
+		job.RunAt = job.DateCreated
+	}
+
+	_, err := r.DB.ExecContext(
+		ctx,
+		query,
+		job.JobID,
+		job.JobType,
+		job.Payload,
+		job.Status,
+		job.Attempts,
+		job.MaxAttempts,
+		job.RunAt,
+		job.DateCreated,
+		job.DateModified,
+	)
+	return err
+}
+
+// ClaimDue marks up to limit due jobs as running and returns them. A job is
+// only returned if this call moved it out of pending, so several workers or
+// processes can poll the same table without running a job twice.
+func (r *JobRepository) ClaimDue(ctx context.Context, limit int) ([]models.Job, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.claim")
+	defer cancel()
+
+	query := `SELECT job_id, job_type, payload, status, attempts, max_attempts, run_at, date_created, date_modified FROM jobs WHERE status = ? AND run_at <= ? ORDER BY run_at LIMIT ?`
+
+	now := time.Now()
+	rows, err := r.DB.QueryContext(ctx, query, models.JobStatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []models.Job
+	for rows.Next() {
+		var job models.Job
+		if err := rows.Scan(
+			&job.JobID,
+			&job.JobType,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.DateCreated,
+			&job.DateModified,
+		); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var claimed []models.Job
+	for _, job := range candidates {
+		result, err := r.DB.ExecContext(ctx, `UPDATE jobs SET status = ?, locked_at = ?, date_modified = ? WHERE job_id = ? AND status = ?`, models.JobStatusRunning, now, now, job.JobID, models.JobStatusPending)
+		if err != nil {
+			return claimed, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return claimed, err
+		}
+		if affected == 1 {
+			job.Status = models.JobStatusRunning
+			claimed = append(claimed, job)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *JobRepository) Complete(ctx context.Context, jobID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.complete")
+	defer cancel()
+
+	query := `UPDATE jobs SET status = ?, attempts = attempts + 1, last_error = NULL, locked_at = NULL, date_modified = ? WHERE job_id = ?`
+	_, err := r.DB.ExecContext(ctx, query, models.JobStatusDone, time.Now(), jobID)
+	return err
+}
+
+// Fail records a failed run. The job goes back to pending and runs again
+// at runAt, or moves to the dead-letter status when status is JobStatusDead.
+func (r *JobRepository) Fail(ctx context.Context, jobID uuid.UUID, status string, lastError string, runAt time.Time) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.fail")
+	defer cancel()
+
+	query := `UPDATE jobs SET status = ?, attempts = attempts + 1, last_error = ?, run_at = ?, locked_at = NULL, date_modified = ? WHERE job_id = ?`
+	_, err := r.DB.ExecContext(ctx, query, status, lastError, runAt, time.Now(), jobID)
+	return err
+}
+
+// Release returns a running job to pending without counting an attempt.
+// The runner releases the jobs a shutdown interrupted, they did not fail.
+func (r *JobRepository) Release(ctx context.Context, jobID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.release")
+	defer cancel()
+
+	query := `UPDATE jobs SET status = ?, locked_at = NULL, date_modified = ? WHERE job_id = ? AND status = ?`
+	_, err := r.DB.ExecContext(ctx, query, models.JobStatusPending, time.Now(), jobID, models.JobStatusRunning)
+	return err
+}
+
+// staleJobError is the last error of jobs whose process died running them
+const staleJobError = "the job was still running when its process stopped"
+
+// RequeueStale returns jobs that have been running for longer than timeout,
+// usually because the process died mid-run, to the pending state. The run
+// counts as a failed attempt, so a job that keeps crashing its process ends
+// up dead. The status is set before attempts, MySQL assigns left to right.
+func (r *JobRepository) RequeueStale(ctx context.Context, timeout time.Duration) (int64, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.requeue_stale")
+	defer cancel()
+
+	query := `UPDATE jobs SET status = CASE WHEN attempts + 1 >= max_attempts THEN ? ELSE ? END, attempts = attempts + 1, last_error = ?, locked_at = NULL, date_modified = ? WHERE status = ? AND locked_at < ?`
+	now := time.Now()
+	result, err := r.DB.ExecContext(ctx, query, models.JobStatusDead, models.JobStatusPending, staleJobError, now, models.JobStatusRunning, now.Add(-timeout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeDone deletes finished jobs older than age. Dead jobs are kept so they
+// can still be inspected.
+func (r *JobRepository) PurgeDone(ctx context.Context, age time.Duration) (int64, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "job.purge")
+	defer cancel()
+
+	query := `DELETE FROM jobs WHERE status = ? AND date_modified < ?`
+	result, err := r.DB.ExecContext(ctx, query, models.JobStatusDone, time.Now().Add(-age))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+func (s *Store) RecordAudit(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.AuditID = uuid.New()
+	entry.DateCreated = time.Now()
+
+	stored := *entry
+	stored.Changes = maps.Clone(entry.Changes)
+	s.audit = append(s.audit, stored)
+	return nil
+}
+
+// recordAudit records a change to one entity if ctx is audited, like the
+// SQL stores do in the transaction of the change. The caller holds the lock.
+func (s *Store) recordAudit(ctx context.Context, entityType, entityID string, changes models.Changes) {
+	entry, ok := repository.AuditFrom(ctx)
+	if !ok || len(changes) == 0 {
+		return
+	}
+	entry.AuditID = uuid.New()
+	entry.DateCreated = time.Now()
+	entry.EntityType = entityType
+	entry.EntityID = entityID
+	entry.Changes = changes
+	s.audit = append(s.audit, entry)
+}
+
+func (s *Store) SearchAudit(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.listAudit(filter)
+	start, end := page(len(entries), filter.Limit, filter.Offset)
+	if start == end {
+		return nil, nil
+	}
+	return entries[start:end], nil
+}
+
+func (s *Store) CountAudit(ctx context.Context, filter repository.AuditFilter) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.listAudit(filter)), nil
+}
+
+// listAudit returns copies of the entries matching filter, newest first
+func (s *Store) listAudit(filter repository.AuditFilter) []models.AuditEntry {
+	var entries []models.AuditEntry
+	for _, entry := range slices.Backward(s.audit) {
+		if filter.Actor != "" && entry.Actor != filter.Actor ||
+			filter.Action != "" && entry.Action != filter.Action ||
+			filter.EntityType != "" && entry.EntityType != filter.EntityType ||
+			filter.EntityID != "" && entry.EntityID != filter.EntityID ||
+			!filter.DateFrom.IsZero() && entry.DateCreated.Before(filter.DateFrom) ||
+			!filter.DateTo.IsZero() && !entry.DateCreated.Before(filter.DateTo) {
+			continue
+		}
+		entry.Changes = maps.Clone(entry.Changes)
+		entries = append(entries, entry)
+	}
+	return entries
+}
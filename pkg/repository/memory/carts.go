@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// GetCart leaves out products that no longer exist, like the join in the
+// SQL repository
+func (s *Store) GetCart(ctx context.Context, cartID uuid.UUID) ([]models.OrderItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []models.OrderItem
+	for _, entry := range s.carts[cartID] {
+		product, ok := s.products[entry.productID]
+		if !ok {
+			continue
+		}
+		items = append(items, models.OrderItem{
+			OrderID:   cartID,
+			ProductID: entry.productID,
+			Quantity:  entry.quantity,
+			Product:   product,
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) AddItem(ctx context.Context, cartID, productID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.carts[cartID] {
+		if entry.productID == productID {
+			return false, nil
+		}
+	}
+	s.carts[cartID] = append(s.carts[cartID], cartItem{productID: productID, quantity: 1})
+	return true, nil
+}
+
+func (s *Store) SetQuantity(ctx context.Context, cartID, productID uuid.UUID, quantity int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart := s.carts[cartID]
+	for i, entry := range cart {
+		if entry.productID != productID {
+			continue
+		}
+		if quantity <= 0 {
+			s.carts[cartID] = append(cart[:i:i], cart[i+1:]...)
+		} else {
+			cart[i].quantity = quantity
+		}
+		break
+	}
+	return nil
+}
+
+func (s *Store) ClearCart(ctx context.Context, cartID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.carts, cartID)
+	return nil
+}
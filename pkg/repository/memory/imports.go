@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+func (s *Store) SaveImport(ctx context.Context, pending *models.ProductImport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending.ImportID = uuid.New()
+	pending.DateCreated = time.Now()
+	stored := *pending
+	stored.Data = bytes.Clone(pending.Data)
+	s.imports[pending.ImportID] = stored
+	return nil
+}
+
+func (s *Store) GetImport(ctx context.Context, importID uuid.UUID) (*models.ProductImport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending, ok := s.imports[importID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	pending.Data = bytes.Clone(pending.Data)
+	return &pending, nil
+}
+
+func (s *Store) DeleteImport(ctx context.Context, importID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.imports, importID)
+	return nil
+}
+
+func (s *Store) PurgeImports(ctx context.Context, age time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	cutoff := time.Now().Add(-age)
+	for importID, pending := range s.imports {
+		if pending.DateCreated.Before(cutoff) {
+			delete(s.imports, importID)
+			purged++
+		}
+	}
+	return purged, nil
+}
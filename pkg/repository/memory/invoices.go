@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+func (s *Store) GetInvoiceByOrderID(ctx context.Context, orderID uuid.UUID) (*models.Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, ok := s.invoices[orderID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &invoice, nil
+}
+
+// IssueInvoice stores invoice under the next invoice number, or returns the
+// invoice the order already has
+func (s *Store) IssueInvoice(ctx context.Context, invoice *models.Invoice) (*models.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.invoices[invoice.OrderID]; ok {
+		return &existing, nil
+	}
+
+	invoice.InvoiceNumber = 1
+	for _, existing := range s.invoices {
+		invoice.InvoiceNumber = max(invoice.InvoiceNumber, existing.InvoiceNumber+1)
+	}
+	invoice.IssuedAt = time.Now()
+	s.invoices[invoice.OrderID] = *invoice
+	return invoice, nil
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// Jobs keeps queued jobs in memory, see Outbox for why it is not part of
+// Store
+type Jobs struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*queuedJob
+}
+
+type queuedJob struct {
+	models.Job
+	lockedAt time.Time
+}
+
+var _ repository.JobStore = (*Jobs)(nil)
+
+func NewJobs() *Jobs {
+	return &Jobs{jobs: map[uuid.UUID]*queuedJob{}}
+}
+
+func (j *Jobs) Enqueue(ctx context.Context, job *models.Job) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job.JobID = uuid.New()
+	job.Status = models.JobStatusPending
+	job.DateCreated = time.Now()
+	job.DateModified = job.DateCreated
+	if job.RunAt.IsZero() {
+		job.RunAt = job.DateCreated
+	}
+	j.jobs[job.JobID] = &queuedJob{Job: *job}
+	return nil
+}
+
+func (j *Jobs) ClaimDue(ctx context.Context, limit int) ([]models.Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var due []*queuedJob
+	for _, job := range j.jobs {
+		if job.Status == models.JobStatusPending && !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	slices.SortFunc(due, func(a, b *queuedJob) int { return a.RunAt.Compare(b.RunAt) })
+
+	claimed := make([]models.Job, 0, min(limit, len(due)))
+	for _, job := range due[:min(limit, len(due))] {
+		job.Status = models.JobStatusRunning
+		job.lockedAt = now
+		job.DateModified = now
+		claimed = append(claimed, job.Job)
+	}
+	return claimed, nil
+}
+
+func (j *Jobs) Complete(ctx context.Context, jobID uuid.UUID) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if job, ok := j.jobs[jobID]; ok {
+		job.Status = models.JobStatusDone
+		job.Attempts++
+		job.LastError = ""
+		job.lockedAt = time.Time{}
+		job.DateModified = time.Now()
+	}
+	return nil
+}
+
+func (j *Jobs) Fail(ctx context.Context, jobID uuid.UUID, status string, lastError string, runAt time.Time) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if job, ok := j.jobs[jobID]; ok {
+		job.Status = status
+		job.Attempts++
+		job.LastError = lastError
+		job.RunAt = runAt
+		job.lockedAt = time.Time{}
+		job.DateModified = time.Now()
+	}
+	return nil
+}
+
+func (j *Jobs) Release(ctx context.Context, jobID uuid.UUID) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if job, ok := j.jobs[jobID]; ok && job.Status == models.JobStatusRunning {
+		job.Status = models.JobStatusPending
+		job.lockedAt = time.Time{}
+		job.DateModified = time.Now()
+	}
+	return nil
+}
+
+// RequeueStale counts the stale run as an attempt, like the SQL store
+func (j *Jobs) RequeueStale(ctx context.Context, timeout time.Duration) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var requeued int64
+	now := time.Now()
+	for _, job := range j.jobs {
+		if job.Status == models.JobStatusRunning && job.lockedAt.Before(now.Add(-timeout)) {
+			job.Attempts++
+			job.Status = models.JobStatusPending
+			if job.Attempts >= job.MaxAttempts {
+				job.Status = models.JobStatusDead
+			}
+			job.LastError = "the job was still running when its process stopped"
+			job.lockedAt = time.Time{}
+			job.DateModified = now
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+func (j *Jobs) PurgeDone(ctx context.Context, age time.Duration) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var purged int64
+	cutoff := time.Now().Add(-age)
+	for jobID, job := range j.jobs {
+		if job.Status == models.JobStatusDone && job.DateModified.Before(cutoff) {
+			delete(j.jobs, jobID)
+			purged++
+		}
+	}
+	return purged, nil
+}
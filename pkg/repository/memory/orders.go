@@ -0,0 +1,193 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+func orderTotal(order models.Order) float64 {
+	total := 0.0
+	for _, item := range order.Items {
+		total += item.Cost
+	}
+	return total
+}
+
+func (s *Store) PlaceOrderWithItems(ctx context.Context, customer models.Customer, orderItems []models.OrderItem) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//Like the SQL store, deleted products can't be ordered
+	for _, item := range orderItems {
+		if _, ok := s.products[item.ProductID]; !ok {
+			return nil, repository.ErrProductNotFound
+		}
+	}
+
+	order := models.Order{
+		OrderID:     uuid.New(),
+		Customer:    customer,
+		OrderStatus: "ordered",
+		OrderDate:   time.Now(),
+		Items:       orderItems,
+	}
+
+	//Keep our own copy of the items, without the products
+	stored := order
+	stored.Items = make([]models.OrderItem, len(orderItems))
+	for i, item := range orderItems {
+		stored.Items[i] = models.OrderItem{
+			OrderID:   order.OrderID,
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Cost:      item.Cost,
+		}
+	}
+	s.orders[order.OrderID] = stored
+
+	return &order, nil
+}
+
+// GetOrderWithProducts leaves out items whose product no longer exists,
+// like the join in the SQL repository
+func (s *Store) GetOrderWithProducts(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.orders[orderID]
+	if !ok {
+		return nil, repository.ErrOrderNotFound
+	}
+
+	order := stored
+	order.Items = nil
+	for _, item := range stored.Items {
+		product, ok := s.products[item.ProductID]
+		if !ok {
+			continue
+		}
+		item.Product = product
+		order.Total += item.Cost
+		order.Items = append(order.Items, item)
+	}
+	return &order, nil
+}
+
+func matchOrder(f repository.OrderFilter, order models.Order) bool {
+	if f.Status != "" && order.OrderStatus != f.Status {
+		return false
+	}
+	if f.Customer != "" && order.Customer.Email != f.Customer {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.HasPrefix(order.OrderID.String(), search) && !strings.Contains(strings.ToLower(order.Customer.Email), search) {
+			return false
+		}
+	}
+	if !inRange(order.OrderDate, f.DateFrom, f.DateTo) {
+		return false
+	}
+	if f.MinTotal != nil && order.Total < *f.MinTotal {
+		return false
+	}
+	if f.MaxTotal != nil && order.Total > *f.MaxTotal {
+		return false
+	}
+	return true
+}
+
+// compareOrders orders orders like OrderFilter.orderBy does in SQL
+func compareOrders(f repository.OrderFilter) func(a, b models.Order) int {
+	return func(a, b models.Order) int {
+		var c int
+		switch f.SortBy {
+		case "id":
+			c = cmp.Compare(a.OrderID.String(), b.OrderID.String())
+		case "customer":
+			c = cmp.Compare(strings.ToLower(a.Customer.Email), strings.ToLower(b.Customer.Email))
+		case "status":
+			c = cmp.Compare(a.OrderStatus, b.OrderStatus)
+		case "date":
+			c = a.OrderDate.Compare(b.OrderDate)
+		case "total":
+			c = cmp.Compare(a.Total, b.Total)
+		default:
+			//Newest first unless a known column is requested
+			c = b.OrderDate.Compare(a.OrderDate)
+			if c != 0 {
+				return c
+			}
+			return cmp.Compare(a.OrderID.String(), b.OrderID.String())
+		}
+
+		if f.SortDesc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+		return cmp.Compare(a.OrderID.String(), b.OrderID.String())
+	}
+}
+
+// listOrders returns the matching orders with their total but without items
+func (s *Store) listOrders(filter repository.OrderFilter) []models.Order {
+	var orders []models.Order
+	for _, stored := range s.orders {
+		order := stored
+		order.Total = orderTotal(stored)
+		order.Items = nil
+		if matchOrder(filter, order) {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+func (s *Store) SearchOrders(ctx context.Context, filter repository.OrderFilter) ([]models.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orders := s.listOrders(filter)
+	slices.SortFunc(orders, compareOrders(filter))
+
+	start, end := page(len(orders), filter.Limit, filter.Offset)
+	if start == end {
+		return nil, nil
+	}
+	return orders[start:end], nil
+}
+
+func (s *Store) CountOrders(ctx context.Context, filter repository.OrderFilter) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.listOrders(filter)), nil
+}
+
+func (s *Store) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return repository.ErrOrderNotFound
+	}
+	previous := order.OrderStatus
+	order.OrderStatus = status
+	s.orders[orderID] = order
+	s.recordAudit(ctx, models.AuditOrder, orderID.String(), models.Diff(
+		map[string]any{"order_status": previous},
+		map[string]any{"order_status": status},
+	))
+	return nil
+}
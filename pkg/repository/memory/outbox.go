@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// Outbox keeps queued emails in memory. Its methods share their names with
+// those of Jobs, so unlike the other stores it is not part of Store.
+type Outbox struct {
+	mu     sync.Mutex
+	emails map[uuid.UUID]*outboxEmail
+}
+
+type outboxEmail struct {
+	models.Email
+	lockedAt time.Time
+}
+
+var _ repository.OutboxStore = (*Outbox)(nil)
+
+func NewOutbox() *Outbox {
+	return &Outbox{emails: map[uuid.UUID]*outboxEmail{}}
+}
+
+func (o *Outbox) Enqueue(ctx context.Context, email *models.Email) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	email.EmailID = uuid.New()
+	email.Status = models.EmailStatusPending
+	email.DateCreated = time.Now()
+	email.NextAttemptAt = email.DateCreated
+	o.emails[email.EmailID] = &outboxEmail{Email: *email}
+	return nil
+}
+
+// ClaimDue marks up to limit due emails as sending and returns them, oldest
+// first, like the SQL outbox
+func (o *Outbox) ClaimDue(ctx context.Context, limit int, staleAfter time.Duration) ([]models.Email, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	var due []*outboxEmail
+	for _, email := range o.emails {
+		pending := email.Status == models.EmailStatusPending && !email.NextAttemptAt.After(now)
+		stale := email.Status == models.EmailStatusSending && email.lockedAt.Before(now.Add(-staleAfter))
+		if pending || stale {
+			due = append(due, email)
+		}
+	}
+	slices.SortFunc(due, func(a, b *outboxEmail) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+
+	claimed := make([]models.Email, 0, min(limit, len(due)))
+	for _, email := range due[:min(limit, len(due))] {
+		email.Status = models.EmailStatusSending
+		email.lockedAt = now
+		claimed = append(claimed, email.Email)
+	}
+	return claimed, nil
+}
+
+func (o *Outbox) MarkSent(ctx context.Context, emailID uuid.UUID) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if email, ok := o.emails[emailID]; ok {
+		now := time.Now()
+		email.Status = models.EmailStatusSent
+		email.Attempts++
+		email.LastError = ""
+		email.SentAt = &now
+		email.lockedAt = time.Time{}
+	}
+	return nil
+}
+
+func (o *Outbox) MarkFailed(ctx context.Context, emailID uuid.UUID, status string, lastError string, nextAttempt time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if email, ok := o.emails[emailID]; ok {
+		email.Status = status
+		email.Attempts++
+		email.LastError = lastError
+		email.NextAttemptAt = nextAttempt
+		email.lockedAt = time.Time{}
+	}
+	return nil
+}
+
+func (o *Outbox) Release(ctx context.Context, emailID uuid.UUID) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if email, ok := o.emails[emailID]; ok && email.Status == models.EmailStatusSending {
+		email.Status = models.EmailStatusPending
+		email.lockedAt = time.Time{}
+	}
+	return nil
+}
+
+// Emails returns every queued email, oldest first
+func (o *Outbox) Emails() []models.Email {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	emails := make([]models.Email, 0, len(o.emails))
+	for _, email := range o.emails {
+		emails = append(emails, email.Email)
+	}
+	slices.SortFunc(emails, func(a, b models.Email) int { return a.DateCreated.Compare(b.DateCreated) })
+	return emails
+}
@@ -0,0 +1,522 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// skuTaken reports whether another product than productID uses sku
+func (s *Store) skuTaken(sku string, productID uuid.UUID) bool {
+	if sku == "" {
+		return false
+	}
+	for _, product := range s.products {
+		if product.SKU == sku && product.ProductID != productID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetProductByID(ctx context.Context, productID uuid.UUID) (*models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	product, ok := s.products[productID]
+	if !ok {
+		return nil, repository.ErrProductNotFound
+	}
+	product.Images = slices.Clone(product.Images)
+	return &product, nil
+}
+
+// GetProductBySlug finds a product by its current slug or one it had before
+func (s *Store) GetProductBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	product, ok := s.products[s.slugs[slug]]
+	if !ok {
+		return nil, repository.ErrProductNotFound
+	}
+	product.Images = slices.Clone(product.Images)
+	return &product, nil
+}
+
+// assignSlug gives product a slug for its name unless its current one still
+// fits, never reusing the slugs of other products
+func (s *Store) assignSlug(product *models.Product) {
+	base := repository.Slugify(product.ProductName)
+	if product.Slug != "" && repository.SlugFits(product.Slug, base) {
+		return
+	}
+	for n := 1; ; n++ {
+		slug := repository.NumberedSlug(base, n)
+		if owner, ok := s.slugs[slug]; !ok || owner == product.ProductID {
+			s.slugs[slug] = product.ProductID
+			product.Slug = slug
+			return
+		}
+	}
+}
+
+// freeSlugs forgets the slugs of a deleted product
+func (s *Store) freeSlugs(productID uuid.UUID) {
+	for slug, owner := range s.slugs {
+		if owner == productID {
+			delete(s.slugs, slug)
+		}
+	}
+}
+
+func (s *Store) CreateProduct(ctx context.Context, product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.skuTaken(product.SKU, uuid.Nil) {
+		return repository.DuplicateSKU(product.SKU)
+	}
+
+	product.ProductID = uuid.New()
+	product.DateCreated = time.Now()
+	product.DateModified = time.Now()
+	product.Version = 1
+	product.Slug = ""
+	product.Images = nil
+	s.assignSlug(product)
+	s.products[product.ProductID] = *product
+	s.recordAudit(ctx, models.AuditProduct, product.ProductID.String(), models.Diff(nil, models.ProductFields(product)))
+	return nil
+}
+
+// UpdateProduct changes the same fields as the SQL repository, an empty
+// image keeps the current one. The category and archived flag have their
+// own operations.
+func (s *Store) UpdateProduct(ctx context.Context, product *models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.products[product.ProductID]
+	if !ok {
+		return repository.ErrProductNotFound
+	}
+	if current.Version != product.Version {
+		return &repository.StaleProductError{Current: current}
+	}
+	if s.skuTaken(product.SKU, product.ProductID) {
+		return repository.DuplicateSKU(product.SKU)
+	}
+
+	previous := current
+	current.SKU = product.SKU
+	current.ProductName = product.ProductName
+	current.Price = product.Price
+	current.Description = product.Description
+	if product.ProductImage != "" {
+		current.ProductImage = product.ProductImage
+	}
+	s.assignSlug(&current)
+	current.DateModified = time.Now()
+	current.Version++
+	s.products[product.ProductID] = current
+	s.recordAudit(ctx, models.AuditProduct, product.ProductID.String(), models.Diff(models.ProductFields(&previous), models.ProductFields(&current)))
+
+	product.DateModified = current.DateModified
+	product.Version = current.Version
+	product.Slug = current.Slug
+	return nil
+}
+
+func (s *Store) DeleteProduct(ctx context.Context, productID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.products[productID]
+	if !ok {
+		return repository.ErrProductNotFound
+	}
+	if orderCount := s.orderCount(productID); orderCount > 0 {
+		return repository.ProductInOrders(orderCount)
+	}
+	delete(s.products, productID)
+	s.freeSlugs(productID)
+	s.recordAudit(ctx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(&previous), nil))
+	return nil
+}
+
+func matchProduct(f repository.ProductFilter, product models.Product) bool {
+	switch f.Archived {
+	case repository.ArchivedOnly:
+		if !product.Archived {
+			return false
+		}
+	case repository.ArchivedInclude:
+	default:
+		if product.Archived {
+			return false
+		}
+	}
+
+	if f.WithImage && product.ProductImage == "" {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(strings.ToLower(product.ProductName), strings.ToLower(f.Name)) {
+		return false
+	}
+	if f.Category != "" && product.Category != f.Category {
+		return false
+	}
+	if f.MinPrice != nil && product.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && product.Price > *f.MaxPrice {
+		return false
+	}
+	return inRange(product.DateCreated, f.DateFrom, f.DateTo)
+}
+
+// compareProducts orders products like ProductFilter.orderBy does in SQL
+func compareProducts(f repository.ProductFilter) func(a, b models.Product) int {
+	return func(a, b models.Product) int {
+		var c int
+		desc := f.SortDesc
+		switch f.SortBy {
+		case "name":
+			c = cmp.Compare(strings.ToLower(a.ProductName), strings.ToLower(b.ProductName))
+		case "price":
+			c = cmp.Compare(a.Price, b.Price)
+		case "category":
+			c = cmp.Compare(strings.ToLower(a.Category), strings.ToLower(b.Category))
+		case "created":
+			c = a.DateCreated.Compare(b.DateCreated)
+		case "modified":
+			c = a.DateModified.Compare(b.DateModified)
+		default:
+			//Newest first unless a known column is requested
+			c = a.DateCreated.Compare(b.DateCreated)
+			desc = true
+		}
+
+		if c == 0 {
+			c = cmp.Compare(a.ProductID.String(), b.ProductID.String())
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	}
+}
+
+// matchingProducts returns the products matching filter in its order,
+// keyset pages included but without applying the limit
+func (s *Store) matchingProducts(filter repository.ProductFilter) []models.Product {
+	compare := compareProducts(filter)
+
+	cursorID, backwards := filter.Cursor()
+	cursor, hasCursor := s.products[cursorID]
+	if cursorID != uuid.Nil && !hasCursor {
+		return nil
+	}
+
+	var products []models.Product
+	for _, product := range s.products {
+		if !matchProduct(filter, product) {
+			continue
+		}
+		if hasCursor {
+			c := compare(product, cursor)
+			if backwards && c >= 0 || !backwards && c <= 0 {
+				continue
+			}
+		}
+		products = append(products, product)
+	}
+	slices.SortFunc(products, compare)
+	return products
+}
+
+func (s *Store) SearchProducts(ctx context.Context, filter repository.ProductFilter) ([]models.Product, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	products := s.matchingProducts(filter)
+	//Pages before the cursor end right before it
+	if _, backwards := filter.Cursor(); backwards && filter.Limit > 0 {
+		products = products[max(len(products)-filter.Limit, 0):]
+	}
+
+	start, end := page(len(products), filter.Limit, filter.Offset)
+	if start == end {
+		return nil, nil
+	}
+	return products[start:end], nil
+}
+
+func (s *Store) CountProducts(ctx context.Context, filter repository.ProductFilter) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.matchingProducts(filter)), nil
+}
+
+func (s *Store) ListCategories(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var categories []string
+	for _, product := range s.products {
+		if product.Category != "" && !slices.Contains(categories, product.Category) {
+			categories = append(categories, product.Category)
+		}
+	}
+	slices.Sort(categories)
+	return categories, nil
+}
+
+// ImportProducts creates or updates products by SKU. Imported products
+// without an image keep their current one, or get the placeholder if they are new.
+func (s *Store) ImportProducts(ctx context.Context, products []models.Product) (created, updated int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bySKU := map[string]models.Product{}
+	for _, product := range s.products {
+		if product.SKU != "" {
+			bySKU[product.SKU] = product
+		}
+	}
+
+	//Check every product before changing any, like the transaction does.
+	//An image may only stay with the product that already has it.
+	imageOwners := map[string]string{}
+	gallery := map[string]bool{}
+	for _, product := range s.products {
+		imageOwners[product.ProductImage] = product.SKU
+		for _, image := range product.Images {
+			gallery[image] = true
+		}
+	}
+	for _, product := range products {
+		image := product.ProductImage
+		if image == "" || image == models.PlaceholderImage {
+			continue
+		}
+		if owner, ok := imageOwners[image]; gallery[image] || ok && (owner == "" || owner != product.SKU) {
+			return 0, 0, fmt.Errorf("sku %s: %w", product.SKU, repository.ImageInUse(image))
+		}
+		imageOwners[image] = product.SKU
+	}
+
+	now := time.Now()
+	for i := range products {
+		product := &products[i]
+
+		if existing, ok := bySKU[product.SKU]; ok {
+			if product.ProductImage == "" {
+				product.ProductImage = existing.ProductImage
+			}
+			product.Images = existing.Images
+			product.ProductID = existing.ProductID
+			product.DateCreated = existing.DateCreated
+			product.DateModified = now
+			product.Version = existing.Version + 1
+			product.Slug = existing.Slug
+			s.assignSlug(product)
+			updated++
+		} else {
+			if product.ProductImage == "" {
+				product.ProductImage = models.PlaceholderImage
+			}
+			product.ProductID = uuid.New()
+			product.DateCreated = now
+			product.DateModified = now
+			product.Version = 1
+			product.Slug = ""
+			product.Images = nil
+			s.assignSlug(product)
+			created++
+		}
+		s.products[product.ProductID] = *product
+		if product.SKU != "" {
+			bySKU[product.SKU] = *product
+		}
+	}
+	s.recordAudit(ctx, models.AuditProduct, "", models.Changes{
+		"created": {After: created},
+		"updated": {After: updated},
+	})
+	return created, updated, nil
+}
+
+// BulkUpdate applies action to all products, or to none of them if any fails
+func (s *Store) BulkUpdate(ctx context.Context, productIDs []uuid.UUID, action repository.BulkAction) ([]repository.BulkResult, error) {
+	if action.Action == repository.BulkPrice && action.Percent <= -100 {
+		return nil, apperr.Validation("A price change of %.2f%% would make prices negative.", action.Percent)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//Work on copies and only write them back once every product succeeded
+	changed := map[uuid.UUID]*models.Product{}
+	results := make([]repository.BulkResult, 0, len(productIDs))
+	failed := false
+	for _, productID := range productIDs {
+		result := repository.BulkResult{ProductID: productID}
+
+		product, ok := s.products[productID]
+		if !ok {
+			result.Err = repository.ErrProductNotFound
+		} else {
+			result.Product = product
+			updated := product
+			result.Message, result.Err = s.applyBulkAction(&updated, action)
+			if action.Action == repository.BulkDelete {
+				changed[productID] = nil
+			} else {
+				changed[productID] = &updated
+				if result.Err == nil {
+					updated.Version++
+					result.After = &updated
+				}
+			}
+		}
+
+		if result.Err != nil {
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if failed {
+		return results, repository.ErrBulkRolledBack
+	}
+
+	for productID, product := range changed {
+		if product == nil {
+			delete(s.products, productID)
+			s.freeSlugs(productID)
+		} else {
+			s.products[productID] = *product
+		}
+	}
+	for _, result := range results {
+		s.recordAudit(ctx, models.AuditProduct, result.ProductID.String(), models.Diff(models.ProductFields(&result.Product), models.ProductFields(result.After)))
+	}
+	return results, nil
+}
+
+// orderCount returns the number of orders productID appears in
+func (s *Store) orderCount(productID uuid.UUID) int {
+	orderCount := 0
+	for _, order := range s.orders {
+		for _, item := range order.Items {
+			if item.ProductID == productID {
+				orderCount++
+			}
+		}
+	}
+	return orderCount
+}
+
+func (s *Store) applyBulkAction(product *models.Product, action repository.BulkAction) (string, error) {
+	now := time.Now()
+
+	switch action.Action {
+	case repository.BulkDelete:
+		//Deleting a product that was ordered would break the order history
+		if orderCount := s.orderCount(product.ProductID); orderCount > 0 {
+			return "", repository.ProductInOrders(orderCount)
+		}
+		return "deleted", nil
+
+	case repository.BulkArchive, repository.BulkUnarchive:
+		product.Archived = action.Action == repository.BulkArchive
+		product.DateModified = now
+		if product.Archived {
+			return "archived", nil
+		}
+		return "restored", nil
+
+	case repository.BulkPrice:
+		price := math.Round(product.Price*(1+action.Percent/100)*100) / 100
+		message := fmt.Sprintf("price changed from $%.2f to $%.2f", product.Price, price)
+		product.Price = price
+		product.DateModified = now
+		return message, nil
+
+	case repository.BulkCategory:
+		product.Category = action.Category
+		product.DateModified = now
+		if action.Category == "" {
+			return "category cleared", nil
+		}
+		return "moved to " + action.Category, nil
+	}
+
+	return "", apperr.Validation("Unknown action %q.", action.Action)
+}
+
+// imageUsed reports whether image is the main image of a product or in the
+// gallery of any
+func (s *Store) imageUsed(image string) bool {
+	for _, product := range s.products {
+		if product.ProductImage == image || slices.Contains(product.Images, image) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) AddProductImage(ctx context.Context, productID uuid.UUID, image string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, ok := s.products[productID]
+	if !ok {
+		return repository.ErrProductNotFound
+	}
+	if len(product.Images) >= repository.MaxProductImages {
+		return repository.GalleryFull(repository.MaxProductImages)
+	}
+	if image != models.PlaceholderImage && s.imageUsed(image) {
+		return repository.ImageInUse(image)
+	}
+
+	previous := product
+	product.Images = append(slices.Clone(product.Images), image)
+	product.DateModified = time.Now()
+	s.products[productID] = product
+	s.recordAudit(ctx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(&previous), models.ProductFields(&product)))
+	return nil
+}
+
+func (s *Store) RemoveProductImage(ctx context.Context, productID uuid.UUID, image string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	product, ok := s.products[productID]
+	if !ok {
+		return repository.ErrProductNotFound
+	}
+	if !slices.Contains(product.Images, image) {
+		return repository.ErrProductImageNotFound
+	}
+
+	previous := product
+	product.Images = slices.DeleteFunc(slices.Clone(product.Images), func(other string) bool { return other == image })
+	product.DateModified = time.Now()
+	s.products[productID] = product
+	s.recordAudit(ctx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(&previous), models.ProductFields(&product)))
+	return nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// ordersIn returns the orders placed in rr
+func (s *Store) ordersIn(rr repository.ReportRange) []models.Order {
+	var orders []models.Order
+	for _, order := range s.orders {
+		if inRange(order.OrderDate, rr.From, rr.To) {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+func (s *Store) Summary(ctx context.Context, rr repository.ReportRange) (models.SalesSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var summary models.SalesSummary
+	for _, order := range s.ordersIn(rr) {
+		summary.Orders++
+		for _, item := range order.Items {
+			summary.Revenue += item.Cost
+			summary.ItemsSold += item.Quantity
+		}
+	}
+
+	summary.Revenue = repository.RoundMoney(summary.Revenue)
+	if summary.Orders > 0 {
+		summary.AverageOrderValue = repository.RoundMoney(summary.Revenue / float64(summary.Orders))
+	}
+	return summary, nil
+}
+
+func (s *Store) RevenueOverTime(ctx context.Context, rr repository.ReportRange, interval string) ([]models.RevenuePoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	series := repository.NewRevenueSeries(rr, interval)
+	for _, order := range s.ordersIn(rr) {
+		series.Add(order.OrderDate, orderTotal(order))
+	}
+	return series.Points(), nil
+}
+
+// TopProducts leaves out products that no longer exist, like the join in
+// the SQL repository
+func (s *Store) TopProducts(ctx context.Context, rr repository.ReportRange, limit int) ([]models.ProductSales, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sales := map[uuid.UUID]*models.ProductSales{}
+	var products []*models.ProductSales
+	for _, order := range s.ordersIn(rr) {
+		for _, item := range order.Items {
+			product, ok := s.products[item.ProductID]
+			if !ok {
+				continue
+			}
+			ps, ok := sales[product.ProductID]
+			if !ok {
+				ps = &models.ProductSales{ProductID: product.ProductID, ProductName: product.ProductName}
+				sales[product.ProductID] = ps
+				products = append(products, ps)
+			}
+			ps.Quantity += item.Quantity
+			ps.Revenue += item.Cost
+		}
+	}
+
+	slices.SortFunc(products, func(a, b *models.ProductSales) int {
+		if c := cmp.Compare(b.Quantity, a.Quantity); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Revenue, a.Revenue); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ProductName, b.ProductName)
+	})
+
+	var top []models.ProductSales
+	for _, ps := range products[:min(limit, len(products))] {
+		ps.Revenue = repository.RoundMoney(ps.Revenue)
+		top = append(top, *ps)
+	}
+	return top, nil
+}
+
+func (s *Store) OrdersByStatus(ctx context.Context, rr repository.ReportRange) ([]models.StatusCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, order := range s.ordersIn(rr) {
+		counts[order.OrderStatus]++
+	}
+
+	var statuses []models.StatusCount
+	for status, orders := range counts {
+		statuses = append(statuses, models.StatusCount{Status: status, Orders: orders})
+	}
+	slices.SortFunc(statuses, func(a, b models.StatusCount) int {
+		if c := cmp.Compare(b.Orders, a.Orders); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Status, b.Status)
+	})
+	return statuses, nil
+}
@@ -0,0 +1,93 @@
+// Package memory implements the repository stores in memory. Nothing is
+// persisted, which makes it useful for tests and demos that should run
+// without a database.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+)
+
+// Store holds every record behind one lock and implements the store
+// interfaces of package repository, but for the outbox and jobs. Records are copied in and out, callers
+// never share memory with the store. Operations never block, so the
+// contexts they take are not consulted.
+type Store struct {
+	mu       sync.RWMutex
+	products map[uuid.UUID]models.Product
+	orders   map[uuid.UUID]models.Order
+	carts    map[uuid.UUID][]cartItem
+	invoices map[uuid.UUID]models.Invoice
+	audit    []models.AuditEntry
+	imports  map[uuid.UUID]models.ProductImport
+	// slugs maps every slug a product ever had to it
+	slugs map[string]uuid.UUID
+}
+
+type cartItem struct {
+	productID uuid.UUID
+	quantity  int
+}
+
+var (
+	_ repository.ProductStore = (*Store)(nil)
+	_ repository.OrderStore   = (*Store)(nil)
+	_ repository.CartStore    = (*Store)(nil)
+	_ repository.InvoiceStore = (*Store)(nil)
+	_ repository.ReportStore  = (*Store)(nil)
+	_ repository.AuditStore   = (*Store)(nil)
+	_ repository.ImportStore  = (*Store)(nil)
+)
+
+func NewStore() *Store {
+	return &Store{
+		products: map[uuid.UUID]models.Product{},
+		orders:   map[uuid.UUID]models.Order{},
+		carts:    map[uuid.UUID][]cartItem{},
+		invoices: map[uuid.UUID]models.Invoice{},
+		imports:  map[uuid.UUID]models.ProductImport{},
+		slugs:    map[string]uuid.UUID{},
+	}
+}
+
+// NewRepository returns a repository backed by a new, empty Store, Outbox
+// and Jobs. Rate limits have their own memory store in package ratelimit.
+func NewRepository() *repository.Repoitory {
+	store := NewStore()
+	return &repository.Repoitory{
+		Product: store,
+		Order:   store,
+		Cart:    store,
+		Invoice: store,
+		Report:  store,
+		Audit:   store,
+		Imports: store,
+		Outbox:  NewOutbox(),
+		Jobs:    NewJobs(),
+	}
+}
+
+// inRange reports whether t falls in [from, to), zero bounds are open
+func inRange(t, from, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && !t.Before(to) {
+		return false
+	}
+	return true
+}
+
+// page applies limit and offset to n items, a zero limit means no limit
+func page(n, limit, offset int) (start, end int) {
+	start = min(max(offset, 0), n)
+	end = n
+	if limit > 0 {
+		end = min(start+limit, n)
+	}
+	return start, end
+}
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	// data optionally migrates rows after the statements ran, in the same
+	// transaction
+	data func(ctx context.Context, tx *Tx) error
+}
+
+// migrations are applied in order and recorded in schema_migrations.
+// Never edit a migration once it has shipped, add a new one instead.
+// Statements must run on every dialect, column types the dialect can't
+// read are rewritten when the migration is applied.
+// Statements must also be idempotent: MySQL commits every schema change
+// right away, so a migration that failed half way is run again from the
+// start. Create tables, indexes and columns IF NOT EXISTS, dialects that
+// lack the clause get it removed and their "already exists" errors ignored.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create products, orders and order_items",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS products (
+				product_id CHAR(36) NOT NULL PRIMARY KEY,
+				product_name VARCHAR(255) NOT NULL,
+				price DECIMAL(10,2) NOT NULL,
+				description TEXT NOT NULL,
+				product_image VARCHAR(255) NOT NULL,
+				date_created DATETIME NOT NULL,
+				date_modified DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS orders (
+				order_id CHAR(36) NOT NULL PRIMARY KEY,
+				user_id VARCHAR(255) NOT NULL,
+				order_status VARCHAR(50) NOT NULL,
+				order_date DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS order_items (
+				order_id CHAR(36) NOT NULL,
+				product_id CHAR(36) NOT NULL,
+				quantity INT NOT NULL,
+				cost DECIMAL(10,2) NOT NULL,
+				PRIMARY KEY (order_id, product_id)
+			)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "create email_outbox",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS email_outbox (
+				email_id CHAR(36) NOT NULL PRIMARY KEY,
+				recipient VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				body TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				last_error TEXT,
+				next_attempt_at DATETIME NOT NULL,
+				sent_at DATETIME NULL,
+				date_created DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox (status, next_attempt_at)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "create jobs",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS jobs (
+				job_id CHAR(36) NOT NULL PRIMARY KEY,
+				job_type VARCHAR(100) NOT NULL,
+				payload TEXT NOT NULL,
+				status VARCHAR(20) NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				max_attempts INT NOT NULL,
+				last_error TEXT,
+				run_at DATETIME NOT NULL,
+				locked_at DATETIME NULL,
+				date_created DATETIME NOT NULL,
+				date_modified DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (status, run_at)`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add category and archived to products",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(100) NOT NULL DEFAULT ''`,
+			`ALTER TABLE products ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE INDEX IF NOT EXISTS idx_products_date_created ON products (date_created)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add sku to products",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(64) NULL`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products (sku)`,
+		},
+	},
+	{
+		version: 6,
+		name:    "create invoices",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS invoices (
+				invoice_number INT NOT NULL PRIMARY KEY,
+				order_id CHAR(36) NOT NULL UNIQUE,
+				subtotal DECIMAL(10,2) NOT NULL,
+				tax_rate DECIMAL(6,4) NOT NULL,
+				tax DECIMAL(10,2) NOT NULL,
+				shipping DECIMAL(10,2) NOT NULL,
+				total DECIMAL(10,2) NOT NULL,
+				issued_at DATETIME NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 7,
+		name:    "create cart_items",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS cart_items (
+				cart_id CHAR(36) NOT NULL,
+				product_id CHAR(36) NOT NULL,
+				quantity INT NOT NULL,
+				date_added DATETIME NOT NULL,
+				PRIMARY KEY (cart_id, product_id)
+			)`,
+		},
+	},
+	{
+		version: 8,
+		name:    "create rate_limits",
+		statements: []string{
+			//updated_at is in Unix nanoseconds, it doubles as the version
+			//updates compare against
+			`CREATE TABLE IF NOT EXISTS rate_limits (
+				bucket_key VARCHAR(255) NOT NULL PRIMARY KEY,
+				tokens DOUBLE PRECISION NOT NULL,
+				updated_at BIGINT NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_rate_limits_updated_at ON rate_limits (updated_at)`,
+		},
+	},
+	{
+		version: 9,
+		name:    "create audit_log",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				audit_id CHAR(36) NOT NULL PRIMARY KEY,
+				actor VARCHAR(255) NOT NULL,
+				remote_ip VARCHAR(64) NOT NULL,
+				request_id VARCHAR(64) NOT NULL,
+				action VARCHAR(64) NOT NULL,
+				entity_type VARCHAR(32) NOT NULL,
+				entity_id VARCHAR(64) NOT NULL,
+				changes TEXT NOT NULL,
+				date_created DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity_type, entity_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_date_created ON audit_log (date_created)`,
+		},
+	},
+	{
+		version: 10,
+		name:    "add version to products",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version: 11,
+		name:    "add slugs to products",
+		statements: []string{
+			`ALTER TABLE products ADD COLUMN IF NOT EXISTS slug VARCHAR(255) NULL`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_products_slug ON products (slug)`,
+			//Every slug a product ever had, so old links keep working
+			`CREATE TABLE IF NOT EXISTS product_slugs (
+				slug VARCHAR(255) NOT NULL PRIMARY KEY,
+				product_id CHAR(36) NOT NULL,
+				date_created DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_product_slugs_product_id ON product_slugs (product_id)`,
+		},
+		data: backfillSlugs,
+	},
+	{
+		version: 12,
+		name:    "add customer_email to orders",
+		statements: []string{
+			//Orders placed before checkout asked for an email have none
+			`ALTER TABLE orders ADD COLUMN IF NOT EXISTS customer_email VARCHAR(255) NOT NULL DEFAULT ''`,
+			`CREATE INDEX IF NOT EXISTS idx_orders_customer_email ON orders (customer_email)`,
+		},
+	},
+	{
+		version: 13,
+		name:    "add locked_at to email_outbox",
+		statements: []string{
+			`ALTER TABLE email_outbox ADD COLUMN IF NOT EXISTS locked_at DATETIME NULL`,
+		},
+	},
+	{
+		version: 14,
+		name:    "compare skus case sensitively",
+		data:    caseSensitiveSKUs,
+	},
+	{
+		version: 15,
+		name:    "create product_imports",
+		statements: []string{
+			//data is the whole validated catalog, which outgrows TEXT on MySQL
+			`CREATE TABLE IF NOT EXISTS product_imports (
+				import_id CHAR(36) NOT NULL PRIMARY KEY,
+				filename VARCHAR(255) NOT NULL,
+				data LONGTEXT NOT NULL,
+				date_created DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_product_imports_date_created ON product_imports (date_created)`,
+		},
+	},
+	{
+		version: 16,
+		name:    "add billing details to orders",
+		statements: []string{
+			`ALTER TABLE orders ADD COLUMN IF NOT EXISTS customer_name VARCHAR(255) NOT NULL DEFAULT ''`,
+			`ALTER TABLE orders ADD COLUMN IF NOT EXISTS billing_address VARCHAR(500) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		version: 17,
+		name:    "create product_images",
+		statements: []string{
+			//An image belongs to one product, removing it from the gallery deletes the file
+			`CREATE TABLE IF NOT EXISTS product_images (
+				image VARCHAR(255) NOT NULL PRIMARY KEY,
+				product_id CHAR(36) NOT NULL,
+				position INT NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_product_images_product_id ON product_images (product_id, position)`,
+		},
+	},
+}
+
+// caseSensitiveSKUs gives the sku column of MySQL a binary collation, so
+// "ab-1" and "AB-1" are different SKUs there too, as they already are on
+// Postgres and SQLite
+func caseSensitiveSKUs(ctx context.Context, tx *Tx) error {
+	if tx.Dialect.Name != MySQL.Name {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `ALTER TABLE products MODIFY sku VARCHAR(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL`)
+	return err
+}
+
+// Migrate brings the database schema up to the latest version.
+func Migrate(ctx context.Context, db *DB) error {
+	ctx, cancel := db.withTimeout(ctx, "schema.migrate")
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx)
+		if err != nil {
+			return err
+		}
+		for _, statement := range m.statements {
+			if _, err := tx.ExecContext(ctx, db.Dialect.ddl.Replace(statement)); err != nil && !isAlreadyExists(err) {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if m.data != nil {
+			if err := m.data(ctx, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func SchemaVersion(ctx context.Context, db *DB) (int, error) {
+	ctx, cancel := db.withTimeout(ctx, "schema.version")
+	defer cancel()
+
+	var version sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// LatestVersion is the schema version Migrate brings the database to
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// CheckSchema fails while the database is behind the latest schema version,
+// e.g. while another instance is still migrating it. A newer schema is fine,
+// it means a newer release is rolling out and migrated first.
+func CheckSchema(ctx context.Context, db *DB) error {
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current < LatestVersion() {
+		return fmt.Errorf("schema is at version %d, expected at least %d", current, LatestVersion())
+	}
+	return nil
+}
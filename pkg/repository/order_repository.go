@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,56 +13,184 @@ import (
 )
 
 type OrderRepository struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func NewOrderRepository(db *sql.DB) *OrderRepository {
+func NewOrderRepository(db *DB) *OrderRepository {
 	return &OrderRepository{DB: db}
 }
 
-func (r *OrderRepository) PlaceOrderWithItems(orderItems []models.OrderItem) error {
+func (r *OrderRepository) PlaceOrderWithItems(ctx context.Context, customer models.Customer, orderItems []models.OrderItem) (*models.Order, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.place")
+	defer cancel()
+
 	//Begin transaction
-	tx, err := r.DB.Begin()
+	tx, err := r.DB.BeginTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	order := models.Order{
 		OrderID:     uuid.New(),
-		UserID:      "vishnu@gmailcom",
+		Customer:    customer,
 		OrderStatus: "ordered",
 		OrderDate:   time.Now(),
 		Items:       orderItems,
 	}
 
 	//insert order into orders table
-	_, err = tx.Exec("INSERT INTO orders (order_id, user_id, order_status, order_date) VALUES (?, ?, ?, ?)", order.OrderID, order.UserID, order.OrderStatus, order.OrderDate)
+	_, err = tx.ExecContext(ctx, "INSERT INTO orders (order_id, user_id, customer_email, customer_name, billing_address, order_status, order_date) VALUES (?, ?, ?, ?, ?, ?, ?)", order.OrderID, order.UserID, order.Customer.Email, order.Customer.Name, order.Customer.Address, order.OrderStatus, order.OrderDate)
 	if err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
+	}
+
+	if err = lockOrderedProducts(ctx, tx, order.Items); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
 	// Insert order items into order_items table
 	for _, item := range order.Items {
-		_, err = tx.Exec("INSERT INTO order_items (order_id, product_id, quantity, cost) VALUES (?, ?, ?, ?)", order.OrderID, item.ProductID, item.Quantity, item.Cost)
+		_, err = tx.ExecContext(ctx, "INSERT INTO order_items (order_id, product_id, quantity, cost) VALUES (?, ?, ?, ?)", order.OrderID, item.ProductID, item.Quantity, item.Cost)
 		if err != nil {
 			tx.Rollback()
-			return err
+			return nil, err
 		}
 	}
 
 	//Commit the transaction
 	if err = tx.Commit(); err != nil {
-		return err
+		return nil, err
+	}
+	return &order, nil
+}
+
+// lockOrderedProducts locks the rows of the products in items and checks
+// they still exist, DeleteProduct holds the same lock while it makes sure a
+// product is in no order. The rows are locked in ID order so two orders of
+// the same products can't deadlock.
+func lockOrderedProducts(ctx context.Context, tx *Tx, items []models.OrderItem) error {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ProductID.String())
+	}
+	slices.Sort(ids)
+
+	for _, id := range slices.Compact(ids) {
+		if _, err := tx.ExecContext(ctx, `UPDATE products SET date_modified = date_modified WHERE product_id = ?`, id); err != nil {
+			return err
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM products WHERE product_id = ?`, id).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrProductNotFound
+		}
 	}
 	return nil
 }
 
-func (r *OrderRepository) ListOrders(limit, offset int) ([]models.Order, error) {
-	query := `SELECT order_id, user_id, order_status, order_date FROM orders ORDER BY order_date DESC LIMIT ? OFFSET ?`
-	rows, err := r.DB.Query(query, limit, offset)
+// OrderFilter narrows down and orders the admin order list. Zero values
+// mean "no restriction".
+type OrderFilter struct {
+	Status   string
+	// Customer is the email of the customer
+	Customer string
+	// Search matches the start of an order ID or any part of the customer email
+	Search   string
+	DateFrom time.Time
+	DateTo   time.Time
+	MinTotal *float64
+	MaxTotal *float64
+	SortBy   string
+	SortDesc bool
+	Limit    int
+	Offset   int
+}
+
+// orderSortColumns maps the sort keys accepted in OrderFilter.SortBy to columns
+var orderSortColumns = map[string]string{
+	"id":     "o.order_id",
+	"customer": "o.customer_email",
+	"status": "o.order_status",
+	"date":   "o.order_date",
+	"total":  "total",
+}
+
+const orderListQuery = `
+	SELECT o.order_id, o.user_id, o.customer_email, o.order_status, o.order_date, COALESCE(t.total, 0) AS total
+	FROM orders o
+	LEFT JOIN (SELECT order_id, SUM(cost) AS total FROM order_items GROUP BY order_id) t ON t.order_id = o.order_id`
+
+func (f OrderFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if f.Status != "" {
+		conditions = append(conditions, "o.order_status = ?")
+		args = append(args, f.Status)
+	}
+	if f.Customer != "" {
+		conditions = append(conditions, "o.customer_email = ?")
+		args = append(args, f.Customer)
+	}
+	if f.Search != "" {
+		//LIKE is case sensitive on PostgreSQL, order IDs are stored in lower case
+		conditions = append(conditions, "(o.order_id LIKE LOWER(?) ESCAPE '!' OR LOWER(o.customer_email) LIKE LOWER(?) ESCAPE '!')")
+		args = append(args, escapeLike(f.Search)+"%", "%"+escapeLike(f.Search)+"%")
+	}
+	if !f.DateFrom.IsZero() {
+		conditions = append(conditions, "o.order_date >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if !f.DateTo.IsZero() {
+		conditions = append(conditions, "o.order_date < ?")
+		args = append(args, f.DateTo)
+	}
+	if f.MinTotal != nil {
+		conditions = append(conditions, "COALESCE(t.total, 0) >= ?")
+		args = append(args, *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		conditions = append(conditions, "COALESCE(t.total, 0) <= ?")
+		args = append(args, *f.MaxTotal)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (f OrderFilter) orderBy() string {
+	column, ok := orderSortColumns[f.SortBy]
+	if !ok {
+		return " ORDER BY o.order_date DESC, o.order_id"
+	}
+
+	direction := "ASC"
+	if f.SortDesc {
+		direction = "DESC"
+	}
+	return " ORDER BY " + column + " " + direction + ", o.order_id"
+}
+
+func (r *OrderRepository) SearchOrders(ctx context.Context, filter OrderFilter) ([]models.Order, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.search")
+	defer cancel()
+
+	where, args := filter.where()
+	query := orderListQuery + where + filter.orderBy()
+	//A zero limit returns every matching order
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		fmt.Println("err: ", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -70,33 +201,74 @@ func (r *OrderRepository) ListOrders(limit, offset int) ([]models.Order, error)
 		err := rows.Scan(
 			&order.OrderID,
 			&order.UserID,
+			&order.Customer.Email,
 			&order.OrderStatus,
 			&order.OrderDate,
+			&order.Total,
 		)
 		if err != nil {
-			fmt.Println("ye err: ", err)
 			return nil, err
 		}
 		orders = append(orders, order)
 	}
-	return orders, nil
+	return orders, rows.Err()
 }
 
-func (r *OrderRepository) GetToatlOrdersCount() (int, error) {
+func (r *OrderRepository) CountOrders(ctx context.Context, filter OrderFilter) (int, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.count")
+	defer cancel()
+
+	where, args := filter.where()
+	query := "SELECT COUNT(*) FROM (" + orderListQuery + where + ") filtered"
+
 	var count int
-	err := r.DB.QueryRow("SELECT COUNT(*) FROM orders").Scan(&count)
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 	return count, nil
 }
 
-func (r *OrderRepository) CreateOrder(order *models.Order) error {
+func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.update_status")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT order_status FROM orders WHERE order_id = ?`, orderID).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrOrderNotFound
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `UPDATE orders SET order_status = ? WHERE order_id = ?`, status, orderID)
+	}
+	if err == nil {
+		err = recordAudit(ctx, tx, models.AuditOrder, orderID.String(), models.Diff(
+			map[string]any{"order_status": previous},
+			map[string]any{"order_status": status},
+		))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *OrderRepository) CreateOrder(ctx context.Context, order *models.Order) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.create")
+	defer cancel()
+
 	query := `INSERT INTO orders (orders_id, UserID, OrderStatus, OrderDate) VALUES (?, ?, ?, ?)`
 	order.OrderID = uuid.New()
 	order.OrderDate = time.Now()
 
-	_, err := r.DB.Exec(
+	_, err := r.DB.ExecContext(
+		ctx,
 		query,
 		order.OrderID,
 		order.UserID,
@@ -106,10 +278,14 @@ func (r *OrderRepository) CreateOrder(order *models.Order) error {
 	return err
 }
 
-func (r *OrderRepository) AddOrderItem(orderItem *models.OrderItem) error {
+func (r *OrderRepository) AddOrderItem(ctx context.Context, orderItem *models.OrderItem) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.add_item")
+	defer cancel()
+
 	query := `INSERT INTO order_items (order_id, product_id, quantity) VALUES (?, ?, ?)`
 
-	_, err := r.DB.Exec(
+	_, err := r.DB.ExecContext(
+		ctx,
 		query,
 		orderItem.OrderID,
 		orderItem.ProductID,
@@ -118,28 +294,37 @@ func (r *OrderRepository) AddOrderItem(orderItem *models.OrderItem) error {
 	return err
 }
 
-func (r *OrderRepository) GetOrderWithProducts(orderID uuid.UUID) (*models.Order, error) {
+func (r *OrderRepository) GetOrderWithProducts(ctx context.Context, orderID uuid.UUID) (*models.Order, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "order.get")
+	defer cancel()
+
 	//First, get the order details
-	orderQuery := `SELECT order_id, user_id, order_status, order_date FROM orders WHERE order_id = ?`
+	orderQuery := `SELECT order_id, user_id, customer_email, customer_name, billing_address, order_status, order_date FROM orders WHERE order_id = ?`
 	var order models.Order
-	err := r.DB.QueryRow(orderQuery, orderID).Scan(
+	err := r.DB.QueryRowContext(ctx, orderQuery, orderID).Scan(
 		&order.OrderID,
 		&order.UserID,
+		&order.Customer.Email,
+		&order.Customer.Name,
+		&order.Customer.Address,
 		&order.OrderStatus,
 		&order.OrderDate,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
 		return nil, err
 	}
 
 	//Then get all order item their corresponding products
 	itemsQuery := `
-		SELECT oi.product_id, oi.quantity, p.product_name, p.price, p.description, p.product_image, p.date_created, p.date_modified 
+		SELECT oi.product_id, oi.quantity, oi.cost, p.product_name, p.price, p.description, p.product_image, p.date_created, p.date_modified 
 		FROM order_items oi 
 		JOIN products p ON oi.product_id = p.product_id
 		WHERE order_id = ?
 	`
-	rows, err := r.DB.Query(itemsQuery, orderID)
+	rows, err := r.DB.QueryContext(ctx, itemsQuery, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +335,7 @@ func (r *OrderRepository) GetOrderWithProducts(orderID uuid.UUID) (*models.Order
 		err := rows.Scan(
 			&item.ProductID,
 			&item.Quantity,
+			&item.Cost,
 			&item.Product.ProductName,
 			&item.Product.Price,
 			&item.Product.Description,
@@ -160,10 +346,11 @@ func (r *OrderRepository) GetOrderWithProducts(orderID uuid.UUID) (*models.Order
 		if err != nil {
 			return nil, err
 		}
+		//Cost is what the customer paid, the product price may have changed since
 		item.OrderID = orderID
-		item.Cost = float64(item.Quantity) * item.Product.Price
 		item.Product.ProductID = item.ProductID
+		order.Total += item.Cost
 		order.Items = append(order.Items, item)
 	}
-	return &order, nil
+	return &order, rows.Err()
 }
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+type OutboxRepository struct {
+	DB *DB
+}
+
+func NewOutboxRepository(db *DB) *OutboxRepository {
+	return &OutboxRepository{DB: db}
+}
+
+func (r *OutboxRepository) Enqueue(ctx context.Context, email *models.Email) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "outbox.enqueue")
+	defer cancel()
+
+	query := `INSERT INTO email_outbox (email_id, recipient, subject, body, status, attempts, next_attempt_at, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	email.EmailID = uuid.New()
+	email.Status = models.EmailStatusPending
+	email.DateCreated = time.Now()
+	email.NextAttemptAt = email.DateCreated
+
+	_, err := r.DB.ExecContext(
+		ctx,
+		query,
+		email.EmailID,
+		email.Recipient,
+		email.Subject,
+		email.Body,
+		email.Status,
+		email.Attempts,
+		email.NextAttemptAt,
+		email.DateCreated,
+	)
+	return err
+}
+
+// ClaimDue marks up to limit due emails as sending and returns them, oldest
+// first. Emails left sending for longer than staleAfter, usually because the
+// process died mid-send, are due again. An email is only returned if this
+// call claimed it, so several processes can flush the same outbox without
+// sending an email twice.
+func (r *OutboxRepository) ClaimDue(ctx context.Context, limit int, staleAfter time.Duration) ([]models.Email, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "outbox.claim")
+	defer cancel()
+
+	const due = `((status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_at < ?))`
+	now := time.Now()
+	dueArgs := []any{models.EmailStatusPending, now, models.EmailStatusSending, now.Add(-staleAfter)}
+
+	query := `SELECT email_id, recipient, subject, body, status, attempts, next_attempt_at, date_created FROM email_outbox WHERE ` + due + ` ORDER BY next_attempt_at LIMIT ?`
+	candidates, err := scanEmails(r.DB.QueryContext(ctx, query, append(dueArgs, limit)...))
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []models.Email
+	for _, email := range candidates {
+		args := append([]any{models.EmailStatusSending, now, email.EmailID}, dueArgs...)
+		result, err := r.DB.ExecContext(ctx, `UPDATE email_outbox SET status = ?, locked_at = ? WHERE email_id = ? AND `+due, args...)
+		if err != nil {
+			return claimed, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return claimed, err
+		}
+		if affected == 1 {
+			email.Status = models.EmailStatusSending
+			claimed = append(claimed, email)
+		}
+	}
+	return claimed, nil
+}
+
+func scanEmails(rows *sql.Rows, err error) ([]models.Email, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []models.Email
+	for rows.Next() {
+		var email models.Email
+		if err := rows.Scan(
+			&email.EmailID,
+			&email.Recipient,
+			&email.Subject,
+			&email.Body,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.DateCreated,
+		); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+func (r *OutboxRepository) MarkSent(ctx context.Context, emailID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "outbox.mark_sent")
+	defer cancel()
+
+	query := `UPDATE email_outbox SET status = ?, attempts = attempts + 1, last_error = NULL, sent_at = ?, locked_at = NULL WHERE email_id = ?`
+	_, err := r.DB.ExecContext(ctx, query, models.EmailStatusSent, time.Now(), emailID)
+	return err
+}
+
+// MarkFailed records a failed delivery attempt. The email is retried at
+// nextAttempt unless status moves it out of the pending state.
+func (r *OutboxRepository) MarkFailed(ctx context.Context, emailID uuid.UUID, status string, lastError string, nextAttempt time.Time) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "outbox.mark_failed")
+	defer cancel()
+
+	query := `UPDATE email_outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?, locked_at = NULL WHERE email_id = ?`
+	_, err := r.DB.ExecContext(ctx, query, status, lastError, nextAttempt, emailID)
+	return err
+}
+
+// Release hands back an email the dispatcher claimed but gave up on before
+// sending it, so the next flush picks it up instead of waiting for the claim
+// to go stale
+func (r *OutboxRepository) Release(ctx context.Context, emailID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "outbox.release")
+	defer cancel()
+
+	query := `UPDATE email_outbox SET status = ?, locked_at = NULL WHERE email_id = ? AND status = ?`
+	_, err := r.DB.ExecContext(ctx, query, models.EmailStatusPending, emailID, models.EmailStatusSending)
+	return err
+}
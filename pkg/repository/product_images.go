@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// MaxProductImages is how many images a product can have besides its main one
+const MaxProductImages = 8
+
+var ErrProductImageNotFound = apperr.NotFound("The image could not be found.")
+
+type rowsQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// productImages returns the gallery of a product, in order
+func productImages(ctx context.Context, q rowsQuerier, productID uuid.UUID) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `SELECT image FROM product_images WHERE product_id = ? ORDER BY position`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []string
+	for rows.Next() {
+		var image string
+		if err := rows.Scan(&image); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func (r *ProductRepository) AddProductImage(ctx context.Context, productID uuid.UUID, image string) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.add_image")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	product, err := lockProductImages(ctx, tx, productID)
+	if err == nil && len(product.Images) >= MaxProductImages {
+		err = GalleryFull(MaxProductImages)
+	}
+	if err == nil {
+		err = checkImageFree(ctx, tx, image, uuid.Nil)
+	}
+	var position int
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(position), 0) FROM product_images WHERE product_id = ?`, productID).Scan(&position)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO product_images (image, product_id, position) VALUES (?, ?, ?)`, image, productID, position+1)
+		if isUniqueViolation(err) {
+			err = ImageInUse(image)
+		}
+	}
+	if err == nil {
+		after := *product
+		after.Images = append(slices.Clone(product.Images), image)
+		err = recordAudit(ctx, tx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(product), models.ProductFields(&after)))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *ProductRepository) RemoveProductImage(ctx context.Context, productID uuid.UUID, image string) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.remove_image")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	product, err := lockProductImages(ctx, tx, productID)
+	if err == nil && !slices.Contains(product.Images, image) {
+		err = ErrProductImageNotFound
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM product_images WHERE image = ? AND product_id = ?`, image, productID)
+	}
+	if err == nil {
+		after := *product
+		after.Images = slices.DeleteFunc(slices.Clone(product.Images), func(other string) bool { return other == image })
+		err = recordAudit(ctx, tx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(product), models.ProductFields(&after)))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockProductImages reads a product with its gallery. Touching the date it
+// was modified locks its row first, so concurrent changes to the gallery are
+// applied one after the other.
+func lockProductImages(ctx context.Context, tx *Tx, productID uuid.UUID) (*models.Product, error) {
+	if _, err := tx.ExecContext(ctx, `UPDATE products SET date_modified = ? WHERE product_id = ?`, time.Now(), productID); err != nil {
+		return nil, err
+	}
+
+	var product models.Product
+	err := scanProduct(tx.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE product_id = ?`, productID), &product)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	product.Images, err = productImages(ctx, tx, productID)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
@@ -1,151 +1,753 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
 	"github.com/snipep/Ecommerce-application/pkg/models"
 )
 
 type ProductRepository struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func NewProductRepository(db *sql.DB) *ProductRepository {
+func NewProductRepository(db *DB) *ProductRepository {
 	return &ProductRepository{DB: db}
 }
 
-func (r *ProductRepository) GetProductByID(productID uuid.UUID) (*models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products WHERE product_id = ?`
-	row := r.DB.QueryRow(query, productID)
+// productColumns is the column list scanProduct expects. Products created
+// before SKUs existed have a NULL sku, which reads as an empty string.
+const productColumns = `product_id, COALESCE(sku, ''), product_name, price, description, product_image, category, archived, date_created, date_modified, version, COALESCE(slug, '')`
 
-	var product models.Product
+type scanner interface {
+	Scan(dest ...any) error
+}
 
-	err := row.Scan(
+func scanProduct(row scanner, product *models.Product) error {
+	return row.Scan(
 		&product.ProductID,
+		&product.SKU,
 		&product.ProductName,
 		&product.Price,
 		&product.Description,
 		&product.ProductImage,
+		&product.Category,
+		&product.Archived,
 		&product.DateCreated,
 		&product.DateModified,
+		&product.Version,
+		&product.Slug,
 	)
-	if err != nil{
+}
+
+func (r *ProductRepository) GetProductByID(ctx context.Context, productID uuid.UUID) (*models.Product, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.get")
+	defer cancel()
+
+	query := `SELECT ` + productColumns + ` FROM products WHERE product_id = ?`
+	row := r.DB.QueryRowContext(ctx, query, productID)
+
+	var product models.Product
+	if err := scanProduct(row, &product); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	images, err := productImages(ctx, r.DB, product.ProductID)
+	if err != nil {
 		return nil, err
 	}
+	product.Images = images
 
 	return &product, nil
 }
 
+// GetProductBySlug finds a product by its current slug or one it had
+// before. The returned product has its current slug, callers redirect when
+// it differs.
+func (r *ProductRepository) GetProductBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.get_by_slug")
+	defer cancel()
+
+	query := `SELECT ` + productColumns + ` FROM products WHERE product_id = (SELECT product_id FROM product_slugs WHERE slug = ?)`
+	row := r.DB.QueryRowContext(ctx, query, slug)
+
+	var product models.Product
+	if err := scanProduct(row, &product); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	images, err := productImages(ctx, r.DB, product.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	product.Images = images
+
+	return &product, nil
+}
 
-func (r *ProductRepository) CreateProduct(product *models.Product) error {
-	query := `INSERT INTO products (product_id, product_name, price, description, product_image, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?)`
+func (r *ProductRepository) CreateProduct(ctx context.Context, product *models.Product) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.create")
+	defer cancel()
+
+	//The slug is recorded along with the product
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	if err := insertProduct(ctx, tx, product); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAudit(ctx, tx, models.AuditProduct, product.ProductID.String(), models.Diff(nil, models.ProductFields(product))); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertProduct(ctx context.Context, db querier, product *models.Product) error {
+	query := `INSERT INTO products (product_id, sku, product_name, price, description, product_image, category, archived, date_created, date_modified, version, slug) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	product.ProductID = uuid.New()
 	product.DateCreated = time.Now()
 	product.DateModified = time.Now()
+	product.Version = 1
+	product.Slug = ""
 
-	_, err := r.DB.Exec(
+	if _, err := assignSlug(ctx, db, product); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(
+		ctx,
 		query,
 		product.ProductID,
+		nullString(product.SKU),
 		product.ProductName,
 		product.Price,
 		product.Description,
 		product.ProductImage,
+		product.Category,
+		product.Archived,
 		product.DateCreated,
 		product.DateModified,
+		product.Version,
+		product.Slug,
 	)
+	if isUniqueViolation(err) {
+		return DuplicateSKU(product.SKU)
+	}
 	return err
 }
 
-func (r *ProductRepository) UpdateProduct(product *models.Product) error {
-	query := `UPDATE products SET product_name = ?, price = ?, description = ?, date_modified = ? WHERE product_id = ?`
+func (r *ProductRepository) UpdateProduct(ctx context.Context, product *models.Product) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.update")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	var previous models.Product
+	err = scanProduct(tx.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE product_id = ?`, product.ProductID), &previous)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+
+	//A renamed product gets a new slug, its old one keeps redirecting
+	product.Slug = previous.Slug
+	if _, err := assignSlug(ctx, tx, product); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	//Only the version the product was loaded at may be updated. The update
+	//always bumps the version, so even MySQL counts the row as affected.
+	//An empty image keeps the current one.
+	query := `UPDATE products SET sku = ?, product_name = ?, price = ?, description = ?, product_image = COALESCE(?, product_image), slug = ?, date_modified = ?, version = version + 1 WHERE product_id = ? AND version = ?`
 
 	product.DateModified = time.Now()
 
-	_, err := r.DB.Exec(
+	result, err := tx.ExecContext(
+		ctx,
 		query,
+		nullString(product.SKU),
 		product.ProductName,
 		product.Price,
 		product.Description,
+		nullString(product.ProductImage),
+		product.Slug,
 		product.DateModified,
 		product.ProductID,
+		product.Version,
 	)
-	return err
+	if err != nil {
+		tx.Rollback()
+		if isUniqueViolation(err) {
+			return DuplicateSKU(product.SKU)
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected == 0 {
+		//Someone else changed the product first
+		tx.Rollback()
+		current, err := r.GetProductByID(ctx, product.ProductID)
+		if err != nil {
+			return err
+		}
+		return &StaleProductError{Current: *current}
+	}
+
+	after := previous
+	after.SKU = product.SKU
+	after.ProductName = product.ProductName
+	after.Price = product.Price
+	after.Description = product.Description
+	if product.ProductImage != "" {
+		after.ProductImage = product.ProductImage
+	}
+	if err := recordAudit(ctx, tx, models.AuditProduct, product.ProductID.String(), models.Diff(models.ProductFields(&previous), models.ProductFields(&after))); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	product.Version++
+	return nil
 }
 
-func(r *ProductRepository) DeleteProduct(productID uuid.UUID) error {
-	query := `DELETE FROM products WHERE product_id = ?`
-	_, err := r.DB.Exec(query, productID)
-	return err
+func (r *ProductRepository) DeleteProduct(ctx context.Context, productID uuid.UUID) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.delete")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	//The orders are counted with the product row locked, PlaceOrderWithItems
+	//locks it as well, so no order can take the product in between
+	previous, err := lockProductImages(ctx, tx, productID)
+	var orderCount int
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE product_id = ?`, productID).Scan(&orderCount)
+	}
+	if err == nil && orderCount > 0 {
+		err = ProductInOrders(orderCount)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM products WHERE product_id = ?`, productID)
+	}
+	if err == nil {
+		//Free the slugs, links to a deleted product can't redirect anywhere
+		_, err = tx.ExecContext(ctx, `DELETE FROM product_slugs WHERE product_id = ?`, productID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM product_images WHERE product_id = ?`, productID)
+	}
+	if err == nil {
+		err = recordAudit(ctx, tx, models.AuditProduct, productID.String(), models.Diff(models.ProductFields(previous), nil))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+const (
+	ArchivedExclude = ""
+	ArchivedOnly    = "archived"
+	ArchivedInclude = "all"
+)
+
+// ProductFilter narrows down and orders the product lists. Zero values mean
+// "no restriction", except that archived products are left out unless
+// Archived asks for them.
+type ProductFilter struct {
+	Name     string
+	Category string
+	MinPrice *float64
+	MaxPrice *float64
+	DateFrom time.Time
+	DateTo   time.Time
+	Archived string
+	// WithImage leaves out products without an image, for the storefront
+	WithImage bool
+	SortBy    string
+	SortDesc  bool
+	Limit     int
+	Offset    int
+	// After and Before page by keyset instead of offset. Only the products
+	// ordered after, or before, the product with that ID match, and Limit
+	// takes the ones nearest to it. Set at most one of them.
+	After  uuid.UUID
+	Before uuid.UUID
+}
+
+// Cursor returns the product a keyset page starts from, and whether the page
+// lies before it
+func (f ProductFilter) Cursor() (uuid.UUID, bool) {
+	if f.Before != uuid.Nil {
+		return f.Before, true
+	}
+	return f.After, false
+}
+
+// order returns the sort column and direction, products with equal values
+// are ordered by ID in the same direction
+func (f ProductFilter) order() (string, bool) {
+	column, ok := productSortColumns[f.SortBy]
+	if !ok {
+		//Newest first unless a known column is requested
+		return "date_created", true
+	}
+	return column, f.SortDesc
+}
+
+// productSortColumns maps the sort keys accepted in ProductFilter.SortBy to columns
+var productSortColumns = map[string]string{
+	"name":     "product_name",
+	"price":    "price",
+	"category": "category",
+	"created":  "date_created",
+	"modified": "date_modified",
 }
 
-func (r *ProductRepository) ListProducts(limit, offset int) ([]models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products LIMIT ? OFFSET ?`
+func (f ProductFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	switch f.Archived {
+	case ArchivedOnly:
+		conditions = append(conditions, "archived = ?")
+		args = append(args, true)
+	case ArchivedInclude:
+	default:
+		conditions = append(conditions, "archived = ?")
+		args = append(args, false)
+	}
 
-	rows, err := r.DB.Query(query, limit, offset)
+	if f.WithImage {
+		conditions = append(conditions, "product_image <> ''")
+	}
+	if f.Name != "" {
+		//LIKE is case sensitive on PostgreSQL
+		conditions = append(conditions, "LOWER(product_name) LIKE LOWER(?) ESCAPE '!'")
+		args = append(args, "%"+escapeLike(f.Name)+"%")
+	}
+	if f.Category != "" {
+		conditions = append(conditions, "category = ?")
+		args = append(args, f.Category)
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, "price >= ?")
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, "price <= ?")
+		args = append(args, *f.MaxPrice)
+	}
+	if !f.DateFrom.IsZero() {
+		conditions = append(conditions, "date_created >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if !f.DateTo.IsZero() {
+		conditions = append(conditions, "date_created < ?")
+		args = append(args, f.DateTo)
+	}
+	if cursor, backwards := f.Cursor(); cursor != uuid.Nil {
+		//Compare the sort key with the cursor's, a deleted cursor matches nothing
+		column, desc := f.order()
+		operator := ">"
+		if desc != backwards {
+			operator = "<"
+		}
+		conditions = append(conditions, "("+column+", product_id) "+operator+" (SELECT "+column+", product_id FROM products WHERE product_id = ?)")
+		args = append(args, cursor)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// orderBy always ends with the primary key so every page is deterministic.
+// Pages before a cursor are read backwards, SearchProducts turns them around.
+func (f ProductFilter) orderBy() string {
+	column, desc := f.order()
+	if _, backwards := f.Cursor(); backwards {
+		desc = !desc
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	return " ORDER BY " + column + " " + direction + ", product_id " + direction
+}
+
+func (r *ProductRepository) SearchProducts(ctx context.Context, filter ProductFilter) ([]models.Product, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.search")
+	defer cancel()
+
+	where, args := filter.where()
+	query := `SELECT ` + productColumns + ` FROM products` + where + filter.orderBy()
+	//A zero limit returns every matching product
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
 	var products []models.Product
-	for rows.Next(){
+	for rows.Next() {
 		var product models.Product
-		if err := rows.Scan(
-			&product.ProductID,
-			&product.ProductName,
-			&product.Price,
-			&product.Description,
-			&product.ProductImage,
-			&product.DateCreated,
-			&product.DateModified,
-		);err != nil{
+		if err := scanProduct(rows, &product); err != nil {
 			return nil, err
 		}
 		products = append(products, product)
 	}
-	return products, nil
+	if _, backwards := filter.Cursor(); backwards {
+		slices.Reverse(products)
+	}
+	return products, rows.Err()
 }
 
-func (r *ProductRepository) GetTotalProductsCount() (int, error) {
+func (r *ProductRepository) CountProducts(ctx context.Context, filter ProductFilter) (int, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.count")
+	defer cancel()
+
+	where, args := filter.where()
+
 	var count int
-	err := r.DB.QueryRow(`SELECT COUNT(*) FROM products`).Scan(&count)
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM products`+where, args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-func (r *ProductRepository) GetProducts(whereClause string) ([]models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products`
+// ListCategories returns every category in use, for filter and bulk action dropdowns.
+func (r *ProductRepository) ListCategories(ctx context.Context) ([]string, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.categories")
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, `SELECT DISTINCT category FROM products WHERE category <> '' ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var category string
+		if err := rows.Scan(&category); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// ImportProducts creates or updates products by SKU in one transaction.
+// Imported products without an image keep their current one, or get the
+// placeholder if they are new.
+func (r *ProductRepository) ImportProducts(ctx context.Context, products []models.Product) (created, updated int, err error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.import")
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range products {
+		product := &products[i]
+
+		var existing models.Product
+		row := tx.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE sku = ?`, product.SKU)
+		err := scanProduct(row, &existing)
+
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			if err := checkImageFree(ctx, tx, product.ProductImage, existing.ProductID); err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("sku %s: %w", product.SKU, err)
+			}
+		}
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if product.ProductImage == "" {
+				product.ProductImage = models.PlaceholderImage
+			}
+			if err := insertProduct(ctx, tx, product); err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("sku %s: %w", product.SKU, err)
+			}
+			created++
+
+		case err != nil:
+			tx.Rollback()
+			return 0, 0, err
+
+		default:
+			if product.ProductImage == "" {
+				product.ProductImage = existing.ProductImage
+			}
+			product.ProductID = existing.ProductID
+			product.DateCreated = existing.DateCreated
+			product.DateModified = time.Now()
+			product.Version = existing.Version + 1
+			product.Slug = existing.Slug
+
+			if _, err := assignSlug(ctx, tx, product); err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("sku %s: %w", product.SKU, err)
+			}
+
+			_, err := tx.ExecContext(
+				ctx,
+				`UPDATE products SET product_name = ?, price = ?, description = ?, product_image = ?, category = ?, archived = ?, slug = ?, date_modified = ?, version = version + 1 WHERE product_id = ?`,
+				product.ProductName,
+				product.Price,
+				product.Description,
+				product.ProductImage,
+				product.Category,
+				product.Archived,
+				product.Slug,
+				product.DateModified,
+				product.ProductID,
+			)
+			if err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("sku %s: %w", product.SKU, err)
+			}
+			updated++
+		}
+	}
+
+	//Imports are recorded as one summary, the catalog file is the detail
+	err = recordAudit(ctx, tx, models.AuditProduct, "", models.Changes{
+		"created": {After: created},
+		"updated": {After: updated},
+	})
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return created, updated, nil
+}
+
+// checkImageFree fails if a product other than productID uses image as its
+// main image, or any product has it in its gallery. The placeholder is
+// excepted.
+func checkImageFree(ctx context.Context, q querier, image string, productID uuid.UUID) error {
+	if image == "" || image == models.PlaceholderImage {
+		return nil
+	}
+
+	var count int
+	err := q.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM products WHERE product_image = ? AND product_id <> ?) + (SELECT COUNT(*) FROM product_images WHERE image = ?)`, image, productID, image).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ImageInUse(image)
+	}
+	return nil
+}
+
+const (
+	BulkDelete    = "delete"
+	BulkArchive   = "archive"
+	BulkUnarchive = "unarchive"
+	BulkPrice     = "price"
+	BulkCategory  = "category"
+)
+
+// BulkAction is applied to every selected product by BulkUpdate. Percent is
+// used by BulkPrice and Category by BulkCategory.
+type BulkAction struct {
+	Action   string
+	Percent  float64
+	Category string
+}
+
+type BulkResult struct {
+	ProductID uuid.UUID
+	Product   models.Product
+	// After is the product once changed, nil if it was deleted or failed
+	After   *models.Product
+	Message string
+	Err     error
+}
+
+// ErrBulkRolledBack is returned when at least one product could not be
+// changed, in which case none of them are.
+var ErrBulkRolledBack = errors.New("bulk action rolled back")
+
+// BulkUpdate applies action to all products in one transaction and reports
+// the outcome for each of them. Result.Product holds the product as it was
+// before the change, Result.After as it is now.
+func (r *ProductRepository) BulkUpdate(ctx context.Context, productIDs []uuid.UUID, action BulkAction) ([]BulkResult, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "product.bulk")
+	defer cancel()
 
-	if whereClause != "" {
-		query += " WHERE " + whereClause
+	if action.Action == BulkPrice && action.Percent <= -100 {
+		return nil, apperr.Validation("A price change of %.2f%% would make prices negative.", action.Percent)
 	}
 
-	query += "ORDER BY date_created DESC"
-	rows, err := r.DB.Query(query)
+	tx, err := r.DB.BeginTx(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var products []models.Product
-	for rows.Next() {
-		var product models.Product
-		if err := rows.Scan(
-			&product.ProductID,
-			&product.ProductName,
-			&product.Price,
-			&product.Description,
-			&product.ProductImage,
-			&product.DateCreated,
-			&product.DateModified,
-		); err != nil {
+	results := make([]BulkResult, 0, len(productIDs))
+	failed := false
+	for _, productID := range productIDs {
+		result := BulkResult{ProductID: productID}
+
+		row := tx.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE product_id = ?`, productID)
+		err := scanProduct(row, &result.Product)
+		if err == nil {
+			//The gallery is deleted along with the product
+			result.Product.Images, err = productImages(ctx, tx, productID)
+		}
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				tx.Rollback()
+				return nil, err
+			}
+			result.Err = ErrProductNotFound
+		} else {
+			updated := result.Product
+			result.Message, result.Err = applyBulkAction(ctx, tx, &updated, action)
+			if result.Err == nil && action.Action != BulkDelete {
+				result.After = &updated
+			}
+		}
+
+		if result.Err != nil {
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if failed {
+		tx.Rollback()
+		return results, ErrBulkRolledBack
+	}
+	for _, result := range results {
+		if err := recordAudit(ctx, tx, models.AuditProduct, result.ProductID.String(), models.Diff(models.ProductFields(&result.Product), models.ProductFields(result.After))); err != nil {
+			tx.Rollback()
 			return nil, err
 		}
-		products = append(products, product)
 	}
-	return products, nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func applyBulkAction(ctx context.Context, tx *Tx, product *models.Product, action BulkAction) (string, error) {
+	now := time.Now()
+
+	switch action.Action {
+	case BulkDelete:
+		//Deleting a product that was ordered would break the order history
+		var orderCount int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE product_id = ?`, product.ProductID).Scan(&orderCount); err != nil {
+			return "", err
+		}
+		if orderCount > 0 {
+			return "", ProductInOrders(orderCount)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM products WHERE product_id = ?`, product.ProductID); err != nil {
+			return "", err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_slugs WHERE product_id = ?`, product.ProductID); err != nil {
+			return "", err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM product_images WHERE product_id = ?`, product.ProductID); err != nil {
+			return "", err
+		}
+		return "deleted", nil
+
+	case BulkArchive, BulkUnarchive:
+		archived := action.Action == BulkArchive
+		if _, err := tx.ExecContext(ctx, `UPDATE products SET archived = ?, date_modified = ?, version = version + 1 WHERE product_id = ?`, archived, now, product.ProductID); err != nil {
+			return "", err
+		}
+		product.Archived, product.DateModified = archived, now
+		product.Version++
+		if archived {
+			return "archived", nil
+		}
+		return "restored", nil
+
+	case BulkPrice:
+		price := math.Round(product.Price*(1+action.Percent/100)*100) / 100
+		if _, err := tx.ExecContext(ctx, `UPDATE products SET price = ?, date_modified = ?, version = version + 1 WHERE product_id = ?`, price, now, product.ProductID); err != nil {
+			return "", err
+		}
+		message := fmt.Sprintf("price changed from $%.2f to $%.2f", product.Price, price)
+		product.Price, product.DateModified = price, now
+		product.Version++
+		return message, nil
+
+	case BulkCategory:
+		if _, err := tx.ExecContext(ctx, `UPDATE products SET category = ?, date_modified = ?, version = version + 1 WHERE product_id = ?`, action.Category, now, product.ProductID); err != nil {
+			return "", err
+		}
+		product.Category, product.DateModified = action.Category, now
+		product.Version++
+		if action.Category == "" {
+			return "category cleared", nil
+		}
+		return "moved to " + action.Category, nil
+	}
 
+	return "", apperr.Validation("Unknown action %q.", action.Action)
 }
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/ratelimit"
+)
+
+// takeAttempts is how often Take retries a bucket another instance updated
+// in the meantime
+const takeAttempts = 3
+
+// RateLimitRepository shares the rate limiter's buckets between instances,
+// it implements ratelimit.Store
+type RateLimitRepository struct {
+	DB *DB
+}
+
+func NewRateLimitRepository(db *DB) *RateLimitRepository {
+	return &RateLimitRepository{DB: db}
+}
+
+// Take updates the bucket only if nobody else did since it was read, like
+// ClaimDue. A bucket that keeps changing under it is busy enough to count as
+// empty.
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "ratelimit.take")
+	defer cancel()
+
+	for attempt := 0; attempt < takeAttempts; attempt++ {
+		var tokens float64
+		var updatedAt int64
+		err := r.DB.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limits WHERE bucket_key = ?`, key).Scan(&tokens, &updatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			left, allowed, wait := limit.Take(float64(limit.Requests), now, now)
+			_, err := r.DB.ExecContext(ctx, `INSERT INTO rate_limits (bucket_key, tokens, updated_at) VALUES (?, ?, ?)`, key, left, now.UnixNano())
+			if isUniqueViolation(err) {
+				continue
+			}
+			if err != nil {
+				return false, 0, err
+			}
+			return allowed, wait, nil
+		}
+		if err != nil {
+			return false, 0, err
+		}
+
+		left, allowed, wait := limit.Take(tokens, time.Unix(0, updatedAt), now)
+		if !allowed {
+			//An empty bucket refills with time alone, there is nothing to write
+			return false, wait, nil
+		}
+
+		//The new version must differ from the old one, even if the clocks of
+		//two instances disagree
+		version := max(now.UnixNano(), updatedAt+1)
+		result, err := r.DB.ExecContext(ctx, `UPDATE rate_limits SET tokens = ?, updated_at = ? WHERE bucket_key = ? AND updated_at = ?`, left, version, key, updatedAt)
+		if err != nil {
+			return false, 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, 0, err
+		}
+		if affected == 1 {
+			return true, 0, nil
+		}
+	}
+	return false, limit.Per / time.Duration(max(limit.Requests, 1)), nil
+}
+
+func (r *RateLimitRepository) Prune(ctx context.Context, before time.Time) error {
+	ctx, cancel := r.DB.withTimeout(ctx, "ratelimit.prune")
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM rate_limits WHERE updated_at < ?`, before.UnixNano())
+	return err
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// Revenue series intervals
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// ReportRepository runs the aggregations behind the admin dashboard. Revenue
+// is what customers paid, the sum of order_items.cost.
+type ReportRepository struct {
+	DB *DB
+}
+
+func NewReportRepository(db *DB) *ReportRepository {
+	return &ReportRepository{DB: db}
+}
+
+// ReportRange limits a report to orders placed in [From, To). Zero values
+// leave that side open.
+type ReportRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (rr ReportRange) where() (string, []any) {
+	where := " WHERE 1 = 1"
+	var args []any
+	if !rr.From.IsZero() {
+		where += " AND o.order_date >= ?"
+		args = append(args, rr.From)
+	}
+	if !rr.To.IsZero() {
+		where += " AND o.order_date < ?"
+		args = append(args, rr.To)
+	}
+	return where, args
+}
+
+func (r *ReportRepository) Summary(ctx context.Context, rr ReportRange) (models.SalesSummary, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "report.summary")
+	defer cancel()
+
+	where, args := rr.where()
+	query := `
+		SELECT COUNT(DISTINCT o.order_id), COALESCE(SUM(oi.cost), 0), COALESCE(SUM(oi.quantity), 0)
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.order_id = o.order_id` + where
+
+	var summary models.SalesSummary
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&summary.Orders, &summary.Revenue, &summary.ItemsSold)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Revenue = RoundMoney(summary.Revenue)
+	if summary.Orders > 0 {
+		summary.AverageOrderValue = RoundMoney(summary.Revenue / float64(summary.Orders))
+	}
+	return summary, nil
+}
+
+// RevenueOverTime returns one point per interval in the range, including
+// the intervals without orders. Orders are bucketed in Go rather than in SQL
+// because date functions differ between databases.
+func (r *ReportRepository) RevenueOverTime(ctx context.Context, rr ReportRange, interval string) ([]models.RevenuePoint, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "report.revenue")
+	defer cancel()
+
+	where, args := rr.where()
+	query := `
+		SELECT o.order_date, COALESCE(SUM(oi.cost), 0)
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.order_id = o.order_id` + where + `
+		GROUP BY o.order_id, o.order_date
+		ORDER BY o.order_date`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := NewRevenueSeries(rr, interval)
+	for rows.Next() {
+		var orderDate time.Time
+		var total float64
+		if err := rows.Scan(&orderDate, &total); err != nil {
+			return nil, err
+		}
+		series.Add(orderDate, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return series.Points(), nil
+}
+
+// RevenueSeries buckets order totals into one point per interval. It is
+// shared by the report stores so they agree on period boundaries.
+type RevenueSeries struct {
+	interval string
+	points   []models.RevenuePoint
+	index    map[time.Time]int
+}
+
+// NewRevenueSeries starts a series with a zero point for every interval of
+// rr, so the chart shows gaps as zero
+func NewRevenueSeries(rr ReportRange, interval string) *RevenueSeries {
+	s := &RevenueSeries{interval: interval, index: map[time.Time]int{}}
+	if !rr.From.IsZero() && !rr.To.IsZero() {
+		for period := truncatePeriod(rr.From, interval); period.Before(rr.To); period = nextPeriod(period, interval) {
+			s.point(period)
+		}
+	}
+	return s
+}
+
+func (s *RevenueSeries) point(period time.Time) *models.RevenuePoint {
+	i, ok := s.index[period]
+	if !ok {
+		s.points = append(s.points, models.RevenuePoint{Period: period})
+		i = len(s.points) - 1
+		s.index[period] = i
+	}
+	return &s.points[i]
+}
+
+// Add counts one order. Orders are bucketed in local time, like the dates
+// of the range.
+func (s *RevenueSeries) Add(orderDate time.Time, total float64) {
+	point := s.point(truncatePeriod(orderDate.In(time.Local), s.interval))
+	point.Orders++
+	point.Revenue += total
+}
+
+// Points returns the series in chronological order
+func (s *RevenueSeries) Points() []models.RevenuePoint {
+	points := make([]models.RevenuePoint, len(s.points))
+	copy(points, s.points)
+	sort.Slice(points, func(i, j int) bool { return points[i].Period.Before(points[j].Period) })
+	for i := range points {
+		points[i].Revenue = RoundMoney(points[i].Revenue)
+	}
+	return points
+}
+
+func (r *ReportRepository) TopProducts(ctx context.Context, rr ReportRange, limit int) ([]models.ProductSales, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "report.top_products")
+	defer cancel()
+
+	where, args := rr.where()
+	query := `
+		SELECT p.product_id, p.product_name, SUM(oi.quantity) AS quantity, SUM(oi.cost) AS revenue
+		FROM order_items oi
+		JOIN orders o ON o.order_id = oi.order_id
+		JOIN products p ON p.product_id = oi.product_id` + where + `
+		GROUP BY p.product_id, p.product_name
+		ORDER BY quantity DESC, revenue DESC, p.product_name
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.ProductSales
+	for rows.Next() {
+		var product models.ProductSales
+		err := rows.Scan(&product.ProductID, &product.ProductName, &product.Quantity, &product.Revenue)
+		if err != nil {
+			return nil, err
+		}
+		product.Revenue = RoundMoney(product.Revenue)
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+func (r *ReportRepository) OrdersByStatus(ctx context.Context, rr ReportRange) ([]models.StatusCount, error) {
+	ctx, cancel := r.DB.withTimeout(ctx, "report.statuses")
+	defer cancel()
+
+	where, args := rr.where()
+	query := `
+		SELECT o.order_status, COUNT(*) AS orders
+		FROM orders o` + where + `
+		GROUP BY o.order_status
+		ORDER BY orders DESC, o.order_status`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []models.StatusCount
+	for rows.Next() {
+		var status models.StatusCount
+		if err := rows.Scan(&status.Status, &status.Orders); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
+
+// truncatePeriod returns the start of the interval t falls in. Weeks start on Monday.
+func truncatePeriod(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch interval {
+	case IntervalWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day
+	}
+}
+
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// RoundMoney rounds amount to whole cents
+func RoundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -1,15 +1,45 @@
 package repository
 
-import "database/sql"
+import (
+	"database/sql"
+	"strings"
+)
 
 type Repoitory struct {
-	Product *ProductRepository
-	Order   *OrderRepository
+	Product ProductStore
+	Order   OrderStore
+	Cart    CartStore
+	Invoice InvoiceStore
+	Report  ReportStore
+	Audit   AuditStore
+	Imports ImportStore
+	Outbox  OutboxStore
+	Jobs    JobStore
+	RateLimits *RateLimitRepository
 }
 
-func NewRepository(db *sql.DB) *Repoitory {
+func NewRepository(db *DB) *Repoitory {
 	return &Repoitory{
 		Product: NewProductRepository(db),
 		Order: NewOrderRepository(db),
+		Cart: NewCartRepository(db),
+		Outbox: NewOutboxRepository(db),
+		Jobs: NewJobRepository(db),
+		Invoice: NewInvoiceRepository(db),
+		Report: NewReportRepository(db),
+		Audit: NewAuditRepository(db),
+		Imports: NewImportRepository(db),
+		RateLimits: NewRateLimitRepository(db),
 	}
-}
\ No newline at end of file
+}
+
+// escapeLike escapes the LIKE wildcards in user input. Queries using it
+// must declare ESCAPE '!', which works the same on every database.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// nullString stores empty strings as NULL, for optional unique columns
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,735 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// openTestDB migrates a fresh SQLite database in a temporary directory. A
+// file is used rather than :memory: so the pool has more than one connection,
+// as it does in production.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := Open(context.Background(), "sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func auditedContext() context.Context {
+	return WithAudit(context.Background(), models.AuditEntry{Actor: "admin@example.com", Action: "test"})
+}
+
+func newProduct(name, sku, image string) *models.Product {
+	return &models.Product{ProductName: name, SKU: sku, Price: 10, Description: name, ProductImage: image}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	if err := CheckSchema(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	//Running it again is a no-op
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != LatestVersion() {
+		t.Errorf("version = %d, want %d", version, LatestVersion())
+	}
+
+	//A database behind the latest version is not ready
+	if _, err := db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, LatestVersion()); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(ctx, db); err == nil {
+		t.Error("CheckSchema accepted an outdated schema")
+	}
+}
+
+func TestProductSlugs(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	first := newProduct("Blue Mug", "", models.PlaceholderImage)
+	second := newProduct("Blue Mug", "", models.PlaceholderImage)
+	for _, product := range []*models.Product{first, second} {
+		if err := products.CreateProduct(ctx, product); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.Slug != "blue-mug" || second.Slug != "blue-mug-2" {
+		t.Fatalf("slugs = %q, %q", first.Slug, second.Slug)
+	}
+
+	first.ProductName = "Red Mug"
+	if err := products.UpdateProduct(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Slug != "red-mug" {
+		t.Errorf("renamed slug = %q", first.Slug)
+	}
+
+	//The old slug still finds the product, and is not given away
+	found, err := products.GetProductBySlug(ctx, "blue-mug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ProductID != first.ProductID || found.Slug != "red-mug" {
+		t.Errorf("old slug found %s at %q", found.ProductID, found.Slug)
+	}
+	third := newProduct("Blue Mug", "", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, third); err != nil {
+		t.Fatal(err)
+	}
+	if third.Slug != "blue-mug-3" {
+		t.Errorf("third slug = %q", third.Slug)
+	}
+}
+
+func TestUpdateProductStaleVersion(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	product := newProduct("Mug", "MUG-1", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *product
+	product.Price = 12
+	if err := products.UpdateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	if product.Version != 2 {
+		t.Errorf("version = %d, want 2", product.Version)
+	}
+
+	stale.Price = 15
+	err := products.UpdateProduct(ctx, &stale)
+	var staleErr *StaleProductError
+	if !errors.As(err, &staleErr) {
+		t.Fatalf("err = %v, want a StaleProductError", err)
+	}
+	if staleErr.Current.Price != 12 {
+		t.Errorf("current price = %v, want 12", staleErr.Current.Price)
+	}
+}
+
+func TestDuplicateSKU(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	if err := products.CreateProduct(ctx, newProduct("Mug", "MUG-1", models.PlaceholderImage)); err != nil {
+		t.Fatal(err)
+	}
+	err := products.CreateProduct(ctx, newProduct("Cup", "MUG-1", models.PlaceholderImage))
+	if !errors.Is(err, apperr.ErrConflict) {
+		t.Errorf("err = %v, want a conflict", err)
+	}
+
+	//SKUs are case sensitive
+	if err := products.CreateProduct(ctx, newProduct("Cup", "mug-1", models.PlaceholderImage)); err != nil {
+		t.Errorf("a SKU differing in case was rejected: %v", err)
+	}
+}
+
+func TestProductImages(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	audit := NewAuditRepository(db)
+	ctx := auditedContext()
+
+	mug := newProduct("Mug", "", "mug.jpg")
+	cup := newProduct("Cup", "", "cup.jpg")
+	for _, product := range []*models.Product{mug, cup} {
+		if err := products.CreateProduct(ctx, product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, image := range []string{"mug-side.jpg", "mug-top.jpg"} {
+		if err := products.AddProductImage(ctx, mug.ProductID, image); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//No image is shared between products, nor with a main image
+	for _, image := range []string{"mug-side.jpg", "cup.jpg"} {
+		if err := products.AddProductImage(ctx, cup.ProductID, image); !errors.Is(err, apperr.ErrConflict) {
+			t.Errorf("adding %s: err = %v, want a conflict", image, err)
+		}
+	}
+
+	if err := products.RemoveProductImage(ctx, mug.ProductID, "mug-side.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := products.RemoveProductImage(ctx, mug.ProductID, "mug-side.jpg"); !errors.Is(err, ErrProductImageNotFound) {
+		t.Errorf("removing twice: err = %v", err)
+	}
+
+	found, err := products.GetProductByID(ctx, mug.ProductID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Images) != 1 || found.Images[0] != "mug-top.jpg" {
+		t.Errorf("images = %v", found.Images)
+	}
+
+	//Create, two additions and the removal
+	count, err := audit.CountAudit(ctx, AuditFilter{EntityID: mug.ProductID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("%d audit entries, want 4", count)
+	}
+
+	if err := products.DeleteProduct(ctx, mug.ProductID); err != nil {
+		t.Fatal(err)
+	}
+	if err := products.AddProductImage(ctx, cup.ProductID, "mug-top.jpg"); err != nil {
+		t.Errorf("the image of a deleted product is still taken: %v", err)
+	}
+}
+
+func TestGalleryFull(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	ctx := context.Background()
+
+	product := newProduct("Mug", "", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxProductImages; i++ {
+		if err := products.AddProductImage(ctx, product.ProductID, uuid.NewString()+".jpg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := products.AddProductImage(ctx, product.ProductID, "one-too-many.jpg")
+	if !errors.Is(err, apperr.ErrValidation) {
+		t.Errorf("err = %v, want a validation error", err)
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	ctx := auditedContext()
+
+	existing := newProduct("Mug", "MUG-1", "mug.jpg")
+	if err := products.CreateProduct(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	created, updated, err := products.ImportProducts(ctx, []models.Product{
+		{SKU: "MUG-1", ProductName: "Mug", Price: 12, Description: "Mug"},
+		{SKU: "CUP-1", ProductName: "Cup", Price: 8, Description: "Cup"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || updated != 1 {
+		t.Errorf("created %d, updated %d", created, updated)
+	}
+
+	found, err := products.GetProductByID(ctx, existing.ProductID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Price != 12 || found.ProductImage != "mug.jpg" {
+		t.Errorf("updated product = %+v", found)
+	}
+
+	//A failing row rolls back the whole import
+	_, _, err = products.ImportProducts(ctx, []models.Product{
+		{SKU: "BOWL-1", ProductName: "Bowl", Price: 5, Description: "Bowl"},
+		{SKU: "PLATE-1", ProductName: "Plate", Price: 5, Description: "Plate", ProductImage: "mug.jpg"},
+	})
+	if err == nil {
+		t.Fatal("an import reusing an image succeeded")
+	}
+	count, err := products.CountProducts(ctx, ProductFilter{Archived: ArchivedInclude})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("%d products after the failed import, want 2", count)
+	}
+}
+
+func TestPendingImports(t *testing.T) {
+	db := openTestDB(t)
+	imports := NewImportRepository(db)
+	ctx := context.Background()
+
+	pending := &models.ProductImport{Filename: "catalog.csv", Data: []byte(`{"Rows":[]}`)}
+	if err := imports.SaveImport(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+	found, err := imports.GetImport(ctx, pending.ImportID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Filename != "catalog.csv" || string(found.Data) != `{"Rows":[]}` {
+		t.Errorf("import = %+v", found)
+	}
+
+	if purged, err := imports.PurgeImports(ctx, time.Hour); err != nil || purged != 0 {
+		t.Errorf("purged %d fresh imports, err %v", purged, err)
+	}
+	if purged, err := imports.PurgeImports(ctx, -time.Second); err != nil || purged != 1 {
+		t.Errorf("purged %d expired imports, err %v", purged, err)
+	}
+	if _, err := imports.GetImport(ctx, pending.ImportID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want not found", err)
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	orders := NewOrderRepository(db)
+	invoices := NewInvoiceRepository(db)
+	ctx := context.Background()
+
+	product := newProduct("Mug", "", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	customer := models.Customer{Email: "ada@example.com", Name: "Ada Lovelace", Address: "1 Main St\nSpringfield"}
+	placed, err := orders.PlaceOrderWithItems(ctx, customer, []models.OrderItem{{ProductID: product.ProductID, Quantity: 2, Cost: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := orders.GetOrderWithProducts(ctx, placed.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Customer != customer {
+		t.Errorf("customer = %+v", order.Customer)
+	}
+	if len(order.Items) != 1 || order.Items[0].Quantity != 2 || order.Items[0].Product.ProductName != "Mug" {
+		t.Errorf("items = %+v", order.Items)
+	}
+
+	//The product is in an order, so it can only be archived
+	if err := products.DeleteProduct(ctx, product.ProductID); !errors.Is(err, apperr.ErrConflict) {
+		t.Errorf("deleting an ordered product: err = %v", err)
+	}
+
+	//A product deleted before the order is placed can't be ordered
+	gone := newProduct("Cup", "", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := products.DeleteProduct(auditedContext(), gone.ProductID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.PlaceOrderWithItems(ctx, customer, []models.OrderItem{{ProductID: product.ProductID, Quantity: 1, Cost: 10}, {ProductID: gone.ProductID, Quantity: 1, Cost: 10}}); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("ordering a deleted product: err = %v", err)
+	}
+
+	first, err := invoices.IssueInvoice(ctx, &models.Invoice{OrderID: order.OrderID, Subtotal: 20, Total: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := invoices.IssueInvoice(ctx, &models.Invoice{OrderID: order.OrderID, Subtotal: 30, Total: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.InvoiceNumber != first.InvoiceNumber || again.Total != 20 {
+		t.Errorf("the order was invoiced twice: %+v, %+v", first, again)
+	}
+}
+
+func TestSearchIgnoresCase(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	orders := NewOrderRepository(db)
+	ctx := context.Background()
+
+	for _, name := range []string{"Blue Mug", "blue cup", "Plate", "50% off"} {
+		if err := products.CreateProduct(ctx, newProduct(name, "", models.PlaceholderImage)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for search, want := range map[string]int{"BLUE": 2, "mUg": 1, "%": 1, "_": 0} {
+		if found, err := products.SearchProducts(ctx, ProductFilter{Name: search}); err != nil || len(found) != want {
+			t.Errorf("searching products for %q found %d, err %v, want %d", search, len(found), err, want)
+		}
+	}
+
+	product := newProduct("Bowl", "", models.PlaceholderImage)
+	if err := products.CreateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	order, err := orders.PlaceOrderWithItems(ctx, models.Customer{Email: "Ada@Example.com"}, []models.OrderItem{{ProductID: product.ProductID, Quantity: 1, Cost: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, search := range []string{"ada@example", "EXAMPLE.COM", strings.ToUpper(order.OrderID.String()[:8])} {
+		if found, err := orders.SearchOrders(ctx, OrderFilter{Search: search}); err != nil || len(found) != 1 {
+			t.Errorf("searching orders for %q found %d, err %v", search, len(found), err)
+		}
+	}
+}
+
+// TestDeleteProductWhileOrdering races a delete against orders of the
+// product, it must either fail or leave no order referring to the product
+func TestDeleteProductWhileOrdering(t *testing.T) {
+	db := openTestDB(t)
+	products := NewProductRepository(db)
+	orders := NewOrderRepository(db)
+	ctx := context.Background()
+
+	for round := 0; round < 10; round++ {
+		product := newProduct("Mug", "", models.PlaceholderImage)
+		if err := products.CreateProduct(ctx, product); err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		var deleteErr error
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			deleteErr = products.DeleteProduct(auditedContext(), product.ProductID)
+		}()
+		for i := 0; i < 3; i++ {
+			go func() {
+				defer wg.Done()
+				orders.PlaceOrderWithItems(ctx, models.Customer{Email: "ada@example.com"}, []models.OrderItem{{ProductID: product.ProductID, Quantity: 1, Cost: 10}})
+			}()
+		}
+		wg.Wait()
+
+		var ordered int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE product_id = ?`, product.ProductID).Scan(&ordered); err != nil {
+			t.Fatal(err)
+		}
+		if deleteErr == nil && ordered > 0 {
+			t.Fatalf("round %d: the product was deleted with %d orders", round, ordered)
+		}
+		if deleteErr != nil && !errors.Is(deleteErr, apperr.ErrConflict) {
+			t.Fatalf("round %d: deleting: %v", round, deleteErr)
+		}
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	db := openTestDB(t)
+	outbox := NewOutboxRepository(db)
+	ctx := context.Background()
+
+	email := &models.Email{Recipient: "ada@example.com", Subject: "Order", Body: "Thanks"}
+	if err := outbox.Enqueue(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := outbox.ClaimDue(ctx, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].EmailID != email.EmailID {
+		t.Fatalf("claimed %+v", claimed)
+	}
+
+	//A claimed email is not handed out again until it goes stale
+	if claimed, err := outbox.ClaimDue(ctx, 10, time.Hour); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d emails twice, err %v", len(claimed), err)
+	}
+
+	//A released email is due again at once, without counting an attempt
+	if err := outbox.Release(ctx, email.EmailID); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = outbox.ClaimDue(ctx, 10, time.Hour)
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 0 {
+		t.Errorf("claimed %+v after release, err %v", claimed, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if claimed, err := outbox.ClaimDue(ctx, 10, time.Millisecond); err != nil || len(claimed) != 1 {
+		t.Errorf("claimed %d stale emails, err %v", len(claimed), err)
+	}
+
+	if err := outbox.MarkSent(ctx, email.EmailID); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := outbox.ClaimDue(ctx, 10, 0); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d sent emails, err %v", len(claimed), err)
+	}
+}
+
+func TestJobClaim(t *testing.T) {
+	db := openTestDB(t)
+	jobs := NewJobRepository(db)
+	ctx := context.Background()
+
+	due := &models.Job{JobType: "test", Payload: "{}", MaxAttempts: 3}
+	later := &models.Job{JobType: "test", Payload: "{}", MaxAttempts: 3, RunAt: time.Now().Add(time.Hour)}
+	for _, job := range []*models.Job{due, later} {
+		if err := jobs.Enqueue(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claimed, err := jobs.ClaimDue(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].JobID != due.JobID {
+		t.Fatalf("claimed %+v", claimed)
+	}
+	if claimed, err := jobs.ClaimDue(ctx, 10); err != nil || len(claimed) != 0 {
+		t.Errorf("claimed %d jobs twice, err %v", len(claimed), err)
+	}
+
+	//A release does not count as an attempt
+	if err := jobs.Release(ctx, due.JobID); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = jobs.ClaimDue(ctx, 10)
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 0 {
+		t.Fatalf("claimed %+v after release, err %v", claimed, err)
+	}
+
+	//A stale run does, until the job runs out of attempts
+	for attempt := 1; attempt <= 3; attempt++ {
+		time.Sleep(10 * time.Millisecond)
+		if requeued, err := jobs.RequeueStale(ctx, time.Millisecond); err != nil || requeued != 1 {
+			t.Fatalf("requeued %d jobs, err %v", requeued, err)
+		}
+		var status string
+		var attempts int
+		if err := db.QueryRowContext(ctx, "SELECT status, attempts FROM jobs WHERE job_id = ?", due.JobID).Scan(&status, &attempts); err != nil {
+			t.Fatal(err)
+		}
+		wantStatus := models.JobStatusPending
+		if attempt == 3 {
+			wantStatus = models.JobStatusDead
+		}
+		if status != wantStatus || attempts != attempt {
+			t.Fatalf("after %d stale runs the job is %s with %d attempts", attempt, status, attempts)
+		}
+		if attempt < 3 {
+			if claimed, err := jobs.ClaimDue(ctx, 10); err != nil || len(claimed) != 1 {
+				t.Fatalf("claimed %d requeued jobs, err %v", len(claimed), err)
+			}
+		}
+	}
+
+	if err := jobs.Complete(ctx, due.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := jobs.PurgeDone(ctx, -time.Second); err != nil || purged != 1 {
+		t.Errorf("purged %d jobs, err %v", purged, err)
+	}
+}
+
+func TestSearchAudit(t *testing.T) {
+	db := openTestDB(t)
+	audit := NewAuditRepository(db)
+	ctx := context.Background()
+
+	for _, entry := range []*models.AuditEntry{
+		{Actor: "ada@example.com", Action: "product.update", EntityType: models.AuditProduct, EntityID: "1", Changes: models.Changes{"price": {Before: 1.0, After: 2.0}}},
+		{Actor: "bob@example.com", Action: "order.status", EntityType: models.AuditOrder, EntityID: "2", Changes: models.Changes{"status": {Before: "ordered", After: "delivered"}}},
+	} {
+		if err := audit.RecordAudit(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := audit.SearchAudit(ctx, AuditFilter{Actor: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "order.status" || entries[0].Changes["status"].After != "delivered" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+// seedReportOrders places four orders of known products on known dates:
+//
+//	2024-03-04 delivered  Mug 2 × 10, Cup 1 × 8          28.00
+//	2024-03-05 ordered    Mug 1 × 10                     10.00
+//	2024-03-12 ordered    Cup 3 for 24.99, Bowl 1 × 5.01 30.00
+//	2024-04-01 cancelled  Bowl 2 for 10.10               10.10
+func seedReportOrders(t *testing.T, db *DB) map[string]uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	products := NewProductRepository(db)
+	orders := NewOrderRepository(db)
+
+	ids := map[string]uuid.UUID{}
+	for _, name := range []string{"Mug", "Cup", "Bowl"} {
+		product := newProduct(name, "", models.PlaceholderImage)
+		if err := products.CreateProduct(ctx, product); err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = product.ProductID
+	}
+
+	item := func(name string, quantity int, cost float64) models.OrderItem {
+		return models.OrderItem{ProductID: ids[name], Quantity: quantity, Cost: cost}
+	}
+	for _, o := range []struct {
+		date   time.Time
+		status string
+		items  []models.OrderItem
+	}{
+		{time.Date(2024, 3, 4, 10, 0, 0, 0, time.Local), "delivered", []models.OrderItem{item("Mug", 2, 20), item("Cup", 1, 8)}},
+		{time.Date(2024, 3, 5, 15, 0, 0, 0, time.Local), "ordered", []models.OrderItem{item("Mug", 1, 10)}},
+		{time.Date(2024, 3, 12, 9, 0, 0, 0, time.Local), "ordered", []models.OrderItem{item("Cup", 3, 24.99), item("Bowl", 1, 5.01)}},
+		{time.Date(2024, 4, 1, 12, 0, 0, 0, time.Local), "cancelled", []models.OrderItem{item("Bowl", 2, 10.10)}},
+	} {
+		order, err := orders.PlaceOrderWithItems(ctx, models.Customer{Email: "ada@example.com"}, o.items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE orders SET order_date = ?, order_status = ? WHERE order_id = ?`, o.date, o.status, order.OrderID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+func TestReportSummary(t *testing.T) {
+	db := openTestDB(t)
+	seedReportOrders(t, db)
+	reports := NewReportRepository(db)
+
+	tests := []struct {
+		name string
+		rr   ReportRange
+		want models.SalesSummary
+	}{
+		{name: "march", rr: ReportRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), To: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)}, want: models.SalesSummary{Orders: 3, Revenue: 68, AverageOrderValue: 22.67, ItemsSold: 8}},
+		{name: "from april", rr: ReportRange{From: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)}, want: models.SalesSummary{Orders: 1, Revenue: 10.10, AverageOrderValue: 10.10, ItemsSold: 2}},
+		{name: "until march 5", rr: ReportRange{To: time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)}, want: models.SalesSummary{Orders: 1, Revenue: 28, AverageOrderValue: 28, ItemsSold: 3}},
+		{name: "no orders", rr: ReportRange{From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)}, want: models.SalesSummary{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := reports.Summary(context.Background(), tt.rr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary != tt.want {
+				t.Errorf("summary %+v, want %+v", summary, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportRevenueOverTime(t *testing.T) {
+	db := openTestDB(t)
+	seedReportOrders(t, db)
+	reports := NewReportRepository(db)
+	date := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name     string
+		rr       ReportRange
+		interval string
+		want     []models.RevenuePoint
+	}{
+		{
+			name:     "days",
+			rr:       ReportRange{From: date(3, 4), To: date(3, 7)},
+			interval: IntervalDay,
+			want:     []models.RevenuePoint{{Period: date(3, 4), Orders: 1, Revenue: 28}, {Period: date(3, 5), Orders: 1, Revenue: 10}, {Period: date(3, 6)}},
+		},
+		{
+			//Weeks start on Monday, March 1st is a Friday
+			name:     "weeks",
+			rr:       ReportRange{From: date(3, 1), To: date(3, 18)},
+			interval: IntervalWeek,
+			want:     []models.RevenuePoint{{Period: date(2, 26)}, {Period: date(3, 4), Orders: 2, Revenue: 38}, {Period: date(3, 11), Orders: 1, Revenue: 30}},
+		},
+		{
+			name:     "months",
+			rr:       ReportRange{From: date(2, 1), To: date(5, 1)},
+			interval: IntervalMonth,
+			want:     []models.RevenuePoint{{Period: date(2, 1)}, {Period: date(3, 1), Orders: 3, Revenue: 68}, {Period: date(4, 1), Orders: 1, Revenue: 10.10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points, err := reports.RevenueOverTime(context.Background(), tt.rr, tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != len(tt.want) {
+				t.Fatalf("points %+v, want %+v", points, tt.want)
+			}
+			for i, point := range points {
+				want := tt.want[i]
+				if !point.Period.Equal(want.Period) || point.Orders != want.Orders || point.Revenue != want.Revenue {
+					t.Errorf("point %d: %+v, want %+v", i, point, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReportTopProductsAndStatuses(t *testing.T) {
+	db := openTestDB(t)
+	ids := seedReportOrders(t, db)
+	reports := NewReportRepository(db)
+	ctx := context.Background()
+	march := ReportRange{From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local), To: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)}
+
+	//Ranked by quantity, the limit cuts off the Bowl
+	top, err := reports.TopProducts(ctx, march, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.ProductSales{
+		{ProductID: ids["Cup"], ProductName: "Cup", Quantity: 4, Revenue: 32.99},
+		{ProductID: ids["Mug"], ProductName: "Mug", Quantity: 3, Revenue: 30},
+	}
+	if !slices.Equal(top, want) {
+		t.Errorf("top products %+v, want %+v", top, want)
+	}
+
+	//Equal counts are ordered by status
+	statuses, err := reports.OrdersByStatus(ctx, ReportRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStatuses := []models.StatusCount{{Status: "ordered", Orders: 2}, {Status: "cancelled", Orders: 1}, {Status: "delivered", Orders: 1}}
+	if !slices.Equal(statuses, wantStatuses) {
+		t.Errorf("statuses %+v, want %+v", statuses, wantStatuses)
+	}
+}
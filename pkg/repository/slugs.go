@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxSlugLength leaves room for a number within the slug columns
+const maxSlugLength = 200
+
+// Slugify turns a product name into the readable part of its URL: lower case
+// ASCII letters and digits separated by single hyphens. Accents are dropped,
+// other characters separate words.
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			//The accent of a decomposed letter
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		default:
+			hyphen = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "product"
+	}
+	return b.String()
+}
+
+// SlugFits reports whether slug is base, possibly numbered to keep it unique
+func SlugFits(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	number, ok := strings.CutPrefix(slug, base+"-")
+	return ok && number != "" && strings.Trim(number, "0123456789") == ""
+}
+
+// NumberedSlug is the n-th candidate for base, the first is base itself
+func NumberedSlug(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+	return fmt.Sprintf("%s-%d", base, n)
+}
+
+var errSlugTaken = apperr.Conflict("Another product was just given the same address, please save again.")
+
+type querier interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// assignSlug gives product a slug for its name unless its current one still
+// fits, and reports whether it changed. Every slug a product ever had is kept
+// in product_slugs so old links redirect, and is never given to another
+// product. The caller writes the slug to the products table.
+func assignSlug(ctx context.Context, q querier, product *models.Product) (bool, error) {
+	base := Slugify(product.ProductName)
+	if product.Slug != "" && SlugFits(product.Slug, base) {
+		return false, nil
+	}
+
+	for n := 1; ; n++ {
+		slug := NumberedSlug(base, n)
+
+		var owner uuid.UUID
+		err := q.QueryRowContext(ctx, `SELECT product_id FROM product_slugs WHERE slug = ?`, slug).Scan(&owner)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err := q.ExecContext(ctx, `INSERT INTO product_slugs (slug, product_id, date_created) VALUES (?, ?, ?)`, slug, product.ProductID, time.Now())
+			if isUniqueViolation(err) {
+				return false, errSlugTaken
+			}
+			if err != nil {
+				return false, err
+			}
+			product.Slug = slug
+			return true, nil
+		case err != nil:
+			return false, err
+		case owner == product.ProductID:
+			//Renamed back to an earlier name, take its slug back
+			product.Slug = slug
+			return true, nil
+		}
+	}
+}
+
+// backfillSlugs gives the products created before slugs existed one
+func backfillSlugs(ctx context.Context, tx *Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT product_id, product_name FROM products WHERE slug IS NULL ORDER BY date_created, product_id`)
+	if err != nil {
+		return err
+	}
+	var products []models.Product
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(&product.ProductID, &product.ProductName); err != nil {
+			rows.Close()
+			return err
+		}
+		products = append(products, product)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range products {
+		if _, err := assignSlug(ctx, tx, &products[i]); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE products SET slug = ? WHERE product_id = ?`, products[i].Slug, products[i].ProductID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
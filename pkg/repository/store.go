@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/snipep/Ecommerce-application/pkg/apperr"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+)
+
+// ErrNotFound is returned by every store when the requested record does not
+// exist. Stores may wrap it in an apperr.Error describing what is missing.
+var ErrNotFound = apperr.ErrNotFound
+
+var (
+	ErrProductNotFound = apperr.NotFound("The product could not be found.")
+	ErrOrderNotFound   = apperr.NotFound("The order could not be found.")
+)
+
+// DuplicateSKU is returned when a product would take the SKU of another one
+func DuplicateSKU(sku string) error {
+	return apperr.Conflict("The SKU %q is already used by another product.", sku)
+}
+
+// StaleProductError is returned when updating a product that was changed
+// since the version the update is based on. Current is the product as it is
+// now, so the user can merge the two.
+type StaleProductError struct {
+	Current models.Product
+}
+
+var errStaleProduct = apperr.Conflict("The product was changed by someone else while you were editing it.")
+
+func (e *StaleProductError) Error() string {
+	return errStaleProduct.Error()
+}
+
+func (e *StaleProductError) Unwrap() error {
+	return errStaleProduct
+}
+
+// ImageInUse is returned when a product would take the image of another
+// one, removing or replacing either product would remove the image of both
+func ImageInUse(image string) error {
+	return apperr.Conflict("The image %q is already used by another product.", image)
+}
+
+// GalleryFull is returned when adding an image to a product that already has
+// the most images it can have
+func GalleryFull(limit int) error {
+	return apperr.Validation("A product can have at most %d more images.", limit)
+}
+
+// ProductInOrders is returned when deleting a product that was ordered,
+// which would break the order history
+func ProductInOrders(orderCount int) error {
+	return apperr.Conflict("The product appears in %d orders, archive it instead.", orderCount)
+}
+
+// The handlers only depend on the interfaces below. The SQL repositories in
+// this package implement them, and package memory provides an in-memory
+// implementation for tests and demos.
+
+type ProductStore interface {
+	GetProductByID(ctx context.Context, productID uuid.UUID) (*models.Product, error)
+	GetProductBySlug(ctx context.Context, slug string) (*models.Product, error)
+	CreateProduct(ctx context.Context, product *models.Product) error
+	UpdateProduct(ctx context.Context, product *models.Product) error
+	DeleteProduct(ctx context.Context, productID uuid.UUID) error
+	SearchProducts(ctx context.Context, filter ProductFilter) ([]models.Product, error)
+	CountProducts(ctx context.Context, filter ProductFilter) (int, error)
+	ListCategories(ctx context.Context) ([]string, error)
+	ImportProducts(ctx context.Context, products []models.Product) (created, updated int, err error)
+	BulkUpdate(ctx context.Context, productIDs []uuid.UUID, action BulkAction) ([]BulkResult, error)
+	// AddProductImage appends image to the gallery of a product
+	AddProductImage(ctx context.Context, productID uuid.UUID, image string) error
+	RemoveProductImage(ctx context.Context, productID uuid.UUID, image string) error
+}
+
+type OrderStore interface {
+	PlaceOrderWithItems(ctx context.Context, customer models.Customer, orderItems []models.OrderItem) (*models.Order, error)
+	GetOrderWithProducts(ctx context.Context, orderID uuid.UUID) (*models.Order, error)
+	SearchOrders(ctx context.Context, filter OrderFilter) ([]models.Order, error)
+	CountOrders(ctx context.Context, filter OrderFilter) (int, error)
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, status string) error
+}
+
+// CartStore keeps the shopping carts of visitors until they place their order
+type CartStore interface {
+	// GetCart returns the items in the cart with their products, oldest first
+	GetCart(ctx context.Context, cartID uuid.UUID) ([]models.OrderItem, error)
+	// AddItem puts one of the product in the cart, it reports false if the
+	// product was already there
+	AddItem(ctx context.Context, cartID, productID uuid.UUID) (bool, error)
+	// SetQuantity changes the quantity of a product in the cart, removing it
+	// when the quantity drops to zero
+	SetQuantity(ctx context.Context, cartID, productID uuid.UUID, quantity int) error
+	ClearCart(ctx context.Context, cartID uuid.UUID) error
+}
+
+type InvoiceStore interface {
+	GetInvoiceByOrderID(ctx context.Context, orderID uuid.UUID) (*models.Invoice, error)
+	IssueInvoice(ctx context.Context, invoice *models.Invoice) (*models.Invoice, error)
+}
+
+// AuditStore keeps the audit trail of admin changes, newest first
+type AuditStore interface {
+	RecordAudit(ctx context.Context, entry *models.AuditEntry) error
+	SearchAudit(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error)
+	CountAudit(ctx context.Context, filter AuditFilter) (int, error)
+}
+
+// ImportStore keeps uploaded catalogs until the admin confirms them
+type ImportStore interface {
+	SaveImport(ctx context.Context, pending *models.ProductImport) error
+	GetImport(ctx context.Context, importID uuid.UUID) (*models.ProductImport, error)
+	DeleteImport(ctx context.Context, importID uuid.UUID) error
+	// PurgeImports removes the imports older than age
+	PurgeImports(ctx context.Context, age time.Duration) (int64, error)
+}
+
+// OutboxStore queues transactional emails until the dispatcher sends them
+type OutboxStore interface {
+	Enqueue(ctx context.Context, email *models.Email) error
+	// ClaimDue marks up to limit due emails as sending and returns them,
+	// emails left sending for longer than staleAfter are due again
+	ClaimDue(ctx context.Context, limit int, staleAfter time.Duration) ([]models.Email, error)
+	MarkSent(ctx context.Context, emailID uuid.UUID) error
+	MarkFailed(ctx context.Context, emailID uuid.UUID, status string, lastError string, nextAttempt time.Time) error
+	// Release returns a claimed email that was not sent to pending, without
+	// counting an attempt
+	Release(ctx context.Context, emailID uuid.UUID) error
+}
+
+// JobStore queues background jobs until the runner claims them
+type JobStore interface {
+	Enqueue(ctx context.Context, job *models.Job) error
+	// ClaimDue marks up to limit due jobs as running and returns them
+	ClaimDue(ctx context.Context, limit int) ([]models.Job, error)
+	Complete(ctx context.Context, jobID uuid.UUID) error
+	Fail(ctx context.Context, jobID uuid.UUID, status string, lastError string, runAt time.Time) error
+	// Release returns a running job to pending without counting an attempt,
+	// for jobs cut short by a shutdown
+	Release(ctx context.Context, jobID uuid.UUID) error
+	// RequeueStale returns jobs running for longer than timeout to pending,
+	// counting the attempt, or to dead once they ran out of attempts
+	RequeueStale(ctx context.Context, timeout time.Duration) (int64, error)
+	// PurgeDone deletes the jobs that finished more than age ago
+	PurgeDone(ctx context.Context, age time.Duration) (int64, error)
+}
+
+type ReportStore interface {
+	Summary(ctx context.Context, rr ReportRange) (models.SalesSummary, error)
+	RevenueOverTime(ctx context.Context, rr ReportRange, interval string) ([]models.RevenuePoint, error)
+	TopProducts(ctx context.Context, rr ReportRange, limit int) ([]models.ProductSales, error)
+	OrdersByStatus(ctx context.Context, rr ReportRange) ([]models.StatusCount, error)
+}
+
+var (
+	_ ProductStore = (*ProductRepository)(nil)
+	_ OrderStore   = (*OrderRepository)(nil)
+	_ CartStore    = (*CartRepository)(nil)
+	_ InvoiceStore = (*InvoiceRepository)(nil)
+	_ ReportStore  = (*ReportRepository)(nil)
+	_ ImportStore  = (*ImportRepository)(nil)
+	_ OutboxStore  = (*OutboxRepository)(nil)
+	_ JobStore     = (*JobRepository)(nil)
+)
@@ -0,0 +1,53 @@
+// Package security sets the response headers that limit what browsers let a
+// page do.
+package security
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentSecurityPolicy only allows scripts, styles and fonts served by the
+// store itself, inline code included. htmx works under it as long as it
+// doesn't inject its indicator styles or evaluate attributes, see the
+// htmx-config of the layouts. Bootstrap draws some controls with data: images.
+var ContentSecurityPolicy = strings.Join([]string{
+	"default-src 'self'",
+	"script-src 'self'",
+	"style-src 'self'",
+	"img-src 'self' data:",
+	"font-src 'self'",
+	"connect-src 'self'",
+	"object-src 'none'",
+	"base-uri 'self'",
+	"form-action 'self'",
+	"frame-ancestors 'none'",
+}, "; ")
+
+// HSTSMaxAge is how long browsers keep to HTTPS after seeing the store over it
+const HSTSMaxAge = 365 * 24 * time.Hour
+
+// Headers returns middleware adding the security headers to every response.
+// HSTS is only sent over HTTPS, terminated here or, with trustProxy, at a
+// proxy that sets X-Forwarded-Proto. Without it clients could send the header
+// themselves.
+func Headers(trustProxy bool) func(http.Handler) http.Handler {
+	hsts := "max-age=" + strconv.Itoa(int(HSTSMaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Content-Security-Policy", ContentSecurityPolicy)
+			h.Set("X-Content-Type-Options", "nosniff")
+			//Older browsers ignore frame-ancestors
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			if r.TLS != nil || (trustProxy && r.Header.Get("X-Forwarded-Proto") == "https") {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package security
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeadersHSTS(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		tls        bool
+		proto      string
+		want       bool
+	}{
+		{name: "plain http", want: false},
+		{name: "tls", tls: true, want: true},
+		{name: "forwarded https behind a proxy", trustProxy: true, proto: "https", want: true},
+		{name: "forwarded http behind a proxy", trustProxy: true, proto: "http", want: false},
+		{name: "forwarded https without a proxy", proto: "https", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			Headers(tt.trustProxy)(http.NotFoundHandler()).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Strict-Transport-Security") != ""; got != tt.want {
+				t.Errorf("HSTS sent: %v, want %v", got, tt.want)
+			}
+			if w.Header().Get("Content-Security-Policy") != ContentSecurityPolicy || w.Header().Get("X-Frame-Options") != "DENY" {
+				t.Errorf("headers %v", w.Header())
+			}
+		})
+	}
+}
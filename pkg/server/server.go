@@ -0,0 +1,158 @@
+// Package server serves the store over plain HTTP, or over HTTPS with
+// certificate files or certificates obtained over ACME. HTTPS is served with
+// HTTP/2.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Server is the store's listener, along with the plain HTTP listener that
+// redirects to it
+type Server struct {
+	HTTP     *http.Server
+	Redirect *http.Server
+	// Mode is http, https or acme
+	Mode string
+
+	certFile string
+	keyFile  string
+}
+
+// New configures the server of handler on addr
+func New(addr string, handler http.Handler, c config.TLSConfig) (*Server, error) {
+	s := &Server{
+		HTTP: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		Mode: "http",
+	}
+
+	//Without ACME there are no challenges to answer, just redirects
+	redirect := redirectHandler(addr)
+	switch {
+	case len(c.ACME.Domains) > 0:
+		manager, err := newManager(c.ACME)
+		if err != nil {
+			return nil, err
+		}
+		s.HTTP.TLSConfig = manager.TLSConfig()
+		s.HTTP.TLSConfig.MinVersion = tls.VersionTLS12
+		redirect = manager.HTTPHandler(redirect)
+		s.Mode = "acme"
+	case c.CertFile != "" || c.KeyFile != "":
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("TLS needs both a certificate and a key file")
+		}
+		s.HTTP.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		s.certFile, s.keyFile = c.CertFile, c.KeyFile
+		s.Mode = "https"
+	}
+
+	if c.RedirectAddr != "" {
+		if s.Mode == "http" {
+			return nil, errors.New("redirecting to HTTPS needs TLS to be configured")
+		}
+		s.Redirect = &http.Server{
+			Addr:              c.RedirectAddr,
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	return s, nil
+}
+
+// newManager obtains and renews certificates for the ACME domains, caching
+// them on disk. It answers tls-alpn-01 challenges itself, http-01 ones need
+// the redirect listener on port 80.
+func newManager(c config.ACMEConfig) (*autocert.Manager, error) {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.Domains...),
+		Cache:      autocert.DirCache(c.CacheDir),
+		Email:      c.Email,
+	}
+	if c.DirectoryURL == "" {
+		return manager, nil
+	}
+
+	client := &acme.Client{DirectoryURL: c.DirectoryURL}
+	if c.CARoot != "" {
+		pem, err := os.ReadFile(c.CARoot)
+		if err != nil {
+			return nil, fmt.Errorf("reading ACME CA root: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in ACME CA root %s", c.CARoot)
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		}
+	}
+	manager.Client = client
+	return manager, nil
+}
+
+// redirectHandler sends requests to the same URL over HTTPS on the port of
+// addr. 308 keeps the method and body of form posts.
+func redirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// ListenAndServe serves until a listener fails, or returns
+// http.ErrServerClosed once Shutdown was called
+func (s *Server) ListenAndServe() error {
+	errs := make(chan error, 2)
+
+	if s.Redirect != nil {
+		go func() {
+			errs <- fmt.Errorf("redirect listener: %w", s.Redirect.ListenAndServe())
+		}()
+	}
+	go func() {
+		if s.Mode == "http" {
+			errs <- s.HTTP.ListenAndServe()
+			return
+		}
+		//net/http enables HTTP/2 on TLS listeners
+		errs <- s.HTTP.ListenAndServeTLS(s.certFile, s.keyFile)
+	}()
+	return <-errs
+}
+
+// Shutdown stops both listeners and waits for the requests in flight to
+// finish, or for ctx to end
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.Redirect != nil {
+		errs = append(errs, s.Redirect.Shutdown(ctx))
+	}
+	errs = append(errs, s.HTTP.Shutdown(ctx))
+	return errors.Join(errs...)
+}
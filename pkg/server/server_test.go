@@ -0,0 +1,480 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snipep/Ecommerce-application/pkg/config"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "ok")
+})
+
+func TestNew(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, "localhost")
+
+	tests := []struct {
+		name    string
+		tls     config.TLSConfig
+		mode    string
+		wantErr bool
+	}{
+		{name: "plain", mode: "http"},
+		{name: "files", tls: config.TLSConfig{CertFile: certFile, KeyFile: keyFile, RedirectAddr: ":8080"}, mode: "https"},
+		{name: "acme", tls: config.TLSConfig{ACME: config.ACMEConfig{Domains: []string{"shop.test"}, CacheDir: t.TempDir()}}, mode: "acme"},
+		{name: "certificate without key", tls: config.TLSConfig{CertFile: certFile}, wantErr: true},
+		{name: "redirect without TLS", tls: config.TLSConfig{RedirectAddr: ":8080"}, wantErr: true},
+		{name: "missing CA root", tls: config.TLSConfig{ACME: config.ACMEConfig{Domains: []string{"shop.test"}, DirectoryURL: "https://ca.test/dir", CARoot: filepath.Join(t.TempDir(), "missing.pem")}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(":8443", okHandler, tt.tls)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("New succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Mode != tt.mode {
+				t.Errorf("mode = %q, want %q", s.Mode, tt.mode)
+			}
+			if (s.Redirect != nil) != (tt.tls.RedirectAddr != "") {
+				t.Errorf("redirect listener = %v", s.Redirect)
+			}
+			if s.Mode != "http" && s.HTTP.TLSConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("minimum TLS version = %x", s.HTTP.TLSConfig.MinVersion)
+			}
+		})
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		want string
+	}{
+		{":8443", "shop.test:8080", "https://shop.test:8443/cart?step=2"},
+		{":443", "shop.test:8080", "https://shop.test/cart?step=2"},
+		{":443", "shop.test", "https://shop.test/cart?step=2"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "http://"+tt.host+"/cart?step=2", nil)
+		w := httptest.NewRecorder()
+		redirectHandler(tt.addr).ServeHTTP(w, r)
+
+		if w.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: status %d", tt.addr, w.Code)
+		}
+		if got := w.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s from %s: Location = %q, want %q", tt.addr, tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestServeTLS serves HTTPS from certificate files, over HTTP/2, until
+// Shutdown
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, "localhost")
+	addr := freeAddr(t)
+
+	s, err := New(addr, okHandler, config.TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+
+	roots := x509.NewCertPool()
+	pemBytes, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots.AppendCertsFromPEM(pemBytes)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "localhost"},
+		ForceAttemptHTTP2: true,
+	}}
+
+	var resp *http.Response
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err = client.Get("https://" + addr + "/")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("status %d over %s", resp.StatusCode, resp.Proto)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("ListenAndServe returned %v", err)
+	}
+}
+
+// TestACME obtains a certificate from a stub ACME server. The stub checks
+// the http-01 challenge through the redirect listener's handler, as a CA
+// would over port 80.
+func TestACME(t *testing.T) {
+	var s *Server
+	ca := newStubCA(t, func(token string) (string, error) {
+		r := httptest.NewRequest(http.MethodGet, "http://shop.test/.well-known/acme-challenge/"+token, nil)
+		w := httptest.NewRecorder()
+		s.Redirect.Handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			return "", fmt.Errorf("challenge answered with status %d", w.Code)
+		}
+		return w.Body.String(), nil
+	})
+
+	var err error
+	s, err = New(":8443", okHandler, config.TLSConfig{
+		RedirectAddr: ":8080",
+		ACME: config.ACMEConfig{
+			Domains:      []string{"shop.test"},
+			Email:        "admin@shop.test",
+			CacheDir:     t.TempDir(),
+			DirectoryURL: ca.URL + "/directory",
+			CARoot:       ca.rootFile,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := &tls.ClientHelloInfo{
+		ServerName:   "shop.test",
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+
+	cert, err := s.HTTP.TLSConfig.GetCertificate(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.VerifyHostname("shop.test") != nil {
+		t.Fatalf("got a certificate for %v", cert.Leaf)
+	}
+	if !ca.challengeValid() {
+		t.Error("the challenge was never answered")
+	}
+
+	//Other domains are refused without asking the CA
+	hello.ServerName = "other.test"
+	if _, err := s.HTTP.TLSConfig.GetCertificate(hello); err == nil {
+		t.Error("got a certificate for a domain that is not configured")
+	}
+
+	//Requests other than challenges are still redirected
+	w := httptest.NewRecorder()
+	s.Redirect.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://shop.test/cart", nil))
+	if w.Code != http.StatusPermanentRedirect {
+		t.Errorf("status %d, want a redirect", w.Code)
+	}
+}
+
+// stubCA implements the parts of ACME autocert uses, without checking
+// signatures: accounts, one order, an http-01 challenge and finalization
+type stubCA struct {
+	*httptest.Server
+	t        *testing.T
+	rootFile string
+	key      *ecdsa.PrivateKey
+	cert     *x509.Certificate
+	fetch    func(token string) (string, error)
+
+	mu        sync.Mutex
+	validated bool
+	leaf      []byte
+}
+
+const stubToken = "stub-token"
+
+func newStubCA(t *testing.T, fetch func(token string) (string, error)) *stubCA {
+	ca := &stubCA{t: t, fetch: fetch}
+	ca.key, ca.cert = newCA(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", ca.directory)
+	mux.HandleFunc("/nonce", ca.nonce)
+	mux.HandleFunc("/account", ca.account)
+	mux.HandleFunc("/new-order", ca.newOrder)
+	mux.HandleFunc("/order", ca.order)
+	mux.HandleFunc("/authz", ca.authz)
+	mux.HandleFunc("/challenge", ca.challenge)
+	mux.HandleFunc("/finalize", ca.finalize)
+	mux.HandleFunc("/cert", ca.certificate)
+	ca.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(ca.Close)
+
+	//The client trusts the stub through the CA root file, as it would Pebble
+	ca.rootFile = filepath.Join(t.TempDir(), "root.pem")
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate().Raw})
+	if err := os.WriteFile(ca.rootFile, root, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func (ca *stubCA) challengeValid() bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.validated
+}
+
+func (ca *stubCA) reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Replay-Nonce", fmt.Sprint(time.Now().UnixNano()))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (ca *stubCA) directory(w http.ResponseWriter, r *http.Request) {
+	ca.reply(w, http.StatusOK, map[string]string{
+		"newNonce":   ca.URL + "/nonce",
+		"newAccount": ca.URL + "/account",
+		"newOrder":   ca.URL + "/new-order",
+		"revokeCert": ca.URL + "/revoke",
+		"keyChange":  ca.URL + "/key-change",
+	})
+}
+
+func (ca *stubCA) nonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprint(time.Now().UnixNano()))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (ca *stubCA) account(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", ca.URL+"/account/1")
+	ca.reply(w, http.StatusCreated, map[string]any{"status": "valid"})
+}
+
+func (ca *stubCA) orderBody() map[string]any {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	body := map[string]any{
+		"identifiers":    []map[string]string{{"type": "dns", "value": "shop.test"}},
+		"authorizations": []string{ca.URL + "/authz"},
+		"finalize":       ca.URL + "/finalize",
+		"status":         "pending",
+	}
+	switch {
+	case ca.leaf != nil:
+		body["status"] = "valid"
+		body["certificate"] = ca.URL + "/cert"
+	case ca.validated:
+		body["status"] = "ready"
+	}
+	return body
+}
+
+func (ca *stubCA) newOrder(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", ca.URL+"/order")
+	ca.reply(w, http.StatusCreated, ca.orderBody())
+}
+
+func (ca *stubCA) order(w http.ResponseWriter, r *http.Request) {
+	ca.reply(w, http.StatusOK, ca.orderBody())
+}
+
+func (ca *stubCA) authz(w http.ResponseWriter, r *http.Request) {
+	status := "pending"
+	if ca.challengeValid() {
+		status = "valid"
+	}
+	ca.reply(w, http.StatusOK, map[string]any{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": "shop.test"},
+		"challenges": []map[string]string{{"type": "http-01", "url": ca.URL + "/challenge", "token": stubToken, "status": status}},
+	})
+}
+
+// challenge validates the http-01 challenge as soon as the client accepts it
+func (ca *stubCA) challenge(w http.ResponseWriter, r *http.Request) {
+	response, err := ca.fetch(stubToken)
+	if err != nil || !strings.HasPrefix(response, stubToken+".") {
+		ca.t.Errorf("challenge response %q, err %v", response, err)
+		ca.reply(w, http.StatusOK, map[string]string{"type": "http-01", "url": ca.URL + "/challenge", "token": stubToken, "status": "invalid"})
+		return
+	}
+
+	ca.mu.Lock()
+	ca.validated = true
+	ca.mu.Unlock()
+	ca.reply(w, http.StatusOK, map[string]string{"type": "http-01", "url": ca.URL + "/challenge", "token": stubToken, "status": "valid"})
+}
+
+// finalize signs the CSR in the request's JWS payload
+func (ca *stubCA) finalize(w http.ResponseWriter, r *http.Request) {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&jws)
+	var decoded []byte
+	if err == nil {
+		decoded, err = base64.RawURLEncoding.DecodeString(jws.Payload)
+	}
+	if err == nil {
+		err = json.Unmarshal(decoded, &payload)
+	}
+	var der []byte
+	if err == nil {
+		der, err = base64.RawURLEncoding.DecodeString(payload.CSR)
+	}
+	var csr *x509.CertificateRequest
+	if err == nil {
+		csr, err = x509.ParseCertificateRequest(der)
+	}
+	if err != nil {
+		ca.t.Errorf("reading CSR: %v", err)
+		ca.reply(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badCSR", "detail": err.Error()})
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Errorf("signing certificate: %v", err)
+		return
+	}
+
+	ca.mu.Lock()
+	ca.leaf = leaf
+	ca.mu.Unlock()
+	w.Header().Set("Location", ca.URL+"/order")
+	ca.reply(w, http.StatusOK, ca.orderBody())
+}
+
+func (ca *stubCA) certificate(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	leaf := ca.leaf
+	ca.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", fmt.Sprint(time.Now().UnixNano()))
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func newCA(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Stub CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// writeCertificate writes a self-signed certificate for host and its key to
+// PEM files
+func writeCertificate(t *testing.T, host string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
@@ -0,0 +1,56 @@
+// Package tracing sets up OpenTelemetry. Spans are started by the packages
+// that own the work, through otel.Tracer, and exported by the provider
+// installed here.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName identifies the store in the tracing backend
+const ServiceName = "ecommerce-store"
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. exporter is "otlp" or "none". The OTLP exporter is configured
+// through the standard OTEL_EXPORTER_OTLP_* variables. The returned function
+// flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, exporter string, sampleRatio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	switch strings.ToLower(exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		otlp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("creating otlp exporter: %w", err)
+		}
+		provider := NewProvider(otlp, sampleRatio)
+		otel.SetTracerProvider(provider)
+		return provider.Shutdown, nil
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q, use otlp or none", exporter)
+	}
+}
+
+// NewProvider returns a provider batching spans to exporter. Tests can pass
+// an in-memory exporter from the sdk's tracetest package.
+func NewProvider(exporter sdktrace.SpanExporter, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+}
@@ -0,0 +1,127 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/snipep/Ecommerce-application/pkg/config"
+	"github.com/snipep/Ecommerce-application/pkg/handlers"
+	"github.com/snipep/Ecommerce-application/pkg/models"
+	"github.com/snipep/Ecommerce-application/pkg/repository"
+	"github.com/snipep/Ecommerce-application/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// recorder receives the spans of every package. The packages start their
+// spans from the global provider, which can only be installed once.
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	os.Exit(m.Run())
+}
+
+// TestRequestSpans serves a product page from SQLite and checks that the
+// request, the repository operation, its query and the template each get a
+// span, nested under the request
+func TestRequestSpans(t *testing.T) {
+	if err := handlers.LoadTemplates(filepath.Join("..", "..")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	db, err := repository.Open(ctx, "sqlite", "file:"+filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := repository.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewRepository(db)
+
+	product := &models.Product{ProductName: "Mug", Price: 10, Description: "A mug", ProductImage: models.PlaceholderImage}
+	if err := repo.Product.CreateProduct(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+
+	h := handlers.NewHandler(repo, nil, &config.Config{BaseURL: "http://shop.test", Store: config.StoreConfig{Name: "Test Store", Currency: "USD"}})
+	r := mux.NewRouter()
+	r.Use(otelmux.Middleware(tracing.ServiceName))
+	r.HandleFunc("/p/{slug}", h.ProductDetail).Methods("GET")
+
+	//Only the spans of the request itself
+	recorder.Reset()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/"+product.Slug, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	request, ok := spans["/p/{slug}"]
+	if !ok {
+		t.Fatalf("no span for the route, got %v", names(recorder.Ended()))
+	}
+	operation, ok := spans["product.get_by_slug"]
+	if !ok {
+		t.Fatalf("no span for the repository operation, got %v", names(recorder.Ended()))
+	}
+	rendering, ok := spans["render productPage"]
+	if !ok {
+		t.Fatalf("no span for the template, got %v", names(recorder.Ended()))
+	}
+
+	if parent := operation.Parent().SpanID(); parent != request.SpanContext().SpanID() {
+		t.Error("the repository span is not a child of the request")
+	}
+	if parent := rendering.Parent().SpanID(); parent != request.SpanContext().SpanID() {
+		t.Error("the render span is not a child of the request")
+	}
+
+	//The product and its gallery are read under the operation
+	var queries int
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() != operation.SpanContext().SpanID() {
+			continue
+		}
+		queries++
+		if span.Name() != "SELECT" || !hasAttribute(span, semconv.DBSystemSqlite) || !hasAttribute(span, semconv.DBOperationName("product.get_by_slug")) {
+			t.Errorf("query span %q has attributes %v", span.Name(), span.Attributes())
+		}
+	}
+	if queries == 0 {
+		t.Error("the repository operation ran no queries")
+	}
+}
+
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, want attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
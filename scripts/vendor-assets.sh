@@ -0,0 +1,41 @@
+#!/bin/sh
+# Copies the front-end libraries the layouts link into static/vendor. npm
+# checks each package against the integrity hash of the registry. Bump a
+# version here and in the templates together, the directory names carry it.
+set -eu
+
+HTMX=2.0.2
+BOOTSTRAP=4.6.2
+FONTAWESOME=6.3.0
+CHARTJS=4.4.4
+
+root=$(cd "$(dirname "$0")/.." && pwd)
+vendor="$root/static/vendor"
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+# fetch <package> <version> unpacks the package into $work/<package>
+fetch() {
+	mkdir -p "$work/$1"
+	tarball=$(cd "$work" && npm pack --silent "$1@$2")
+	tar -xzf "$work/$tarball" -C "$work/$1" --strip-components=1
+}
+
+fetch htmx.org "$HTMX"
+mkdir -p "$vendor/htmx/$HTMX"
+cp "$work/htmx.org/dist/htmx.min.js" "$work/htmx.org/LICENSE" "$vendor/htmx/$HTMX/"
+
+fetch bootstrap "$BOOTSTRAP"
+mkdir -p "$vendor/bootstrap/$BOOTSTRAP/css"
+cp "$work/bootstrap/dist/css/bootstrap.min.css" "$work/bootstrap/dist/css/bootstrap.min.css.map" "$vendor/bootstrap/$BOOTSTRAP/css/"
+cp "$work/bootstrap/LICENSE" "$vendor/bootstrap/$BOOTSTRAP/"
+
+# The CSS build of Font Awesome, the SVG one injects styles the CSP blocks
+fetch @fortawesome/fontawesome-free "$FONTAWESOME"
+mkdir -p "$vendor/fontawesome/$FONTAWESOME/css"
+cp "$work/@fortawesome/fontawesome-free/css/all.min.css" "$vendor/fontawesome/$FONTAWESOME/css/"
+cp -R "$work/@fortawesome/fontawesome-free/webfonts" "$work/@fortawesome/fontawesome-free/LICENSE.txt" "$vendor/fontawesome/$FONTAWESOME/"
+
+fetch chart.js "$CHARTJS"
+mkdir -p "$vendor/chart.js/$CHARTJS"
+cp "$work/chart.js/dist/chart.umd.js" "$work/chart.js/LICENSE.md" "$vendor/chart.js/$CHARTJS/"
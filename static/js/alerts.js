@@ -0,0 +1,22 @@
+// Error alerts are swapped into #alerts by the server. Dismiss them on click
+// or after a while, so they don't cover the page.
+(function () {
+    var timer;
+
+    document.addEventListener("htmx:afterSwap", function (event) {
+        if (event.detail.target.id !== "alerts") {
+            return;
+        }
+        clearTimeout(timer);
+        timer = setTimeout(function () {
+            event.detail.target.innerHTML = "";
+        }, 8000);
+    });
+
+    document.addEventListener("click", function (event) {
+        var alerts = document.getElementById("alerts");
+        if (alerts && alerts.contains(event.target)) {
+            alerts.innerHTML = "";
+        }
+    });
+})();
@@ -0,0 +1,139 @@
+// Renders the admin dashboard from the /reports JSON endpoints
+(function () {
+    var form = document.getElementById("reportRange");
+    var charts = {};
+
+    var money = new Intl.NumberFormat(undefined, { style: "currency", currency: "USD" });
+
+    function query() {
+        return new URLSearchParams(new FormData(form)).toString();
+    }
+
+    function getJSON(path) {
+        return fetch(path + "?" + query(), { headers: { Accept: "application/json" } }).then(function (response) {
+            return response.json().then(function (body) {
+                if (!response.ok) {
+                    throw new Error(body.error || path + ": " + response.status);
+                }
+                return body;
+            });
+        });
+    }
+
+    function showError(message) {
+        var alerts = document.getElementById("alerts");
+        var alert = document.createElement("div");
+        alert.className = "alert alert-danger shadow-sm mb-0";
+        alert.setAttribute("role", "alert");
+        alert.textContent = message;
+        alerts.replaceChildren(alert);
+    }
+
+    function drawChart(id, config) {
+        if (charts[id]) {
+            charts[id].destroy();
+        }
+        charts[id] = new Chart(document.getElementById(id), config);
+    }
+
+    function periodLabel(period, interval) {
+        var date = new Date(period);
+        if (interval === "month") {
+            return date.toLocaleDateString(undefined, { year: "numeric", month: "short" });
+        }
+        return date.toLocaleDateString(undefined, { month: "short", day: "numeric" });
+    }
+
+    function loadSummary() {
+        return getJSON("/reports/summary").then(function (summary) {
+            document.getElementById("summaryRevenue").textContent = money.format(summary.revenue);
+            document.getElementById("summaryOrders").textContent = summary.orders;
+            document.getElementById("summaryAverage").textContent = money.format(summary.average_order_value);
+            document.getElementById("summaryItems").textContent = summary.items_sold;
+        });
+    }
+
+    function loadRevenue() {
+        return getJSON("/reports/revenue").then(function (data) {
+            var points = data.points || [];
+            document.getElementById("reportInterval").value = data.interval;
+            drawChart("revenueChart", {
+                type: "line",
+                data: {
+                    labels: points.map(function (p) { return periodLabel(p.period, data.interval); }),
+                    datasets: [
+                        { label: "Revenue", data: points.map(function (p) { return p.revenue; }), yAxisID: "revenue", tension: 0.3 },
+                        { label: "Orders", data: points.map(function (p) { return p.orders; }), yAxisID: "orders", type: "bar" }
+                    ]
+                },
+                options: {
+                    scales: {
+                        revenue: { position: "left", beginAtZero: true },
+                        orders: { position: "right", beginAtZero: true, grid: { drawOnChartArea: false }, ticks: { precision: 0 } }
+                    }
+                }
+            });
+        });
+    }
+
+    function loadStatuses() {
+        return getJSON("/reports/statuses").then(function (statuses) {
+            statuses = statuses || [];
+            drawChart("statusChart", {
+                type: "doughnut",
+                data: {
+                    labels: statuses.map(function (s) { return s.status; }),
+                    datasets: [{ data: statuses.map(function (s) { return s.orders; }) }]
+                }
+            });
+        });
+    }
+
+    function loadTopProducts() {
+        return getJSON("/reports/top-products").then(function (products) {
+            var body = document.getElementById("topProducts");
+            body.replaceChildren();
+            (products || []).forEach(function (product) {
+                var row = body.insertRow();
+                row.insertCell().textContent = product.product_name;
+                row.insertCell().textContent = product.quantity;
+                row.insertCell().textContent = money.format(product.revenue);
+            });
+            if (!body.rows.length) {
+                body.insertRow().insertCell().textContent = "No sales in this period";
+            }
+        });
+    }
+
+    function load() {
+        history.replaceState(null, "", "/dashboard?" + query());
+        Promise.all([loadSummary(), loadRevenue(), loadStatuses(), loadTopProducts()]).catch(function (err) {
+            console.error("loading dashboard:", err);
+            showError(err.message);
+        });
+    }
+
+    function isoDate(date) {
+        var local = new Date(date.getTime() - date.getTimezoneOffset() * 60000);
+        return local.toISOString().slice(0, 10);
+    }
+
+    form.addEventListener("submit", function (event) {
+        event.preventDefault();
+        load();
+    });
+
+    form.querySelectorAll("[data-days]").forEach(function (button) {
+        button.addEventListener("click", function () {
+            var to = new Date();
+            var from = new Date();
+            from.setDate(to.getDate() - (parseInt(button.dataset.days, 10) - 1));
+            document.getElementById("reportFrom").value = isoDate(from);
+            document.getElementById("reportTo").value = isoDate(to);
+            document.getElementById("reportInterval").value = "";
+            load();
+        });
+    });
+
+    load();
+})();